@@ -0,0 +1,79 @@
+package matf
+
+import (
+	"fmt"
+)
+
+// Categorical represents a MATLAB categorical array
+type Categorical struct {
+	Codes       []int    // Index into Categories starting at 1, 0 for undefined elements.
+	Categories  []string // Names of the categories.
+	IsOrdinal   bool
+	IsProtected bool
+}
+
+// readBool returns the value of a logical scalar
+func readBool(mat MatMatrix) (bool, error) {
+	value, err := readScalar(mat)
+	if err != nil {
+		return false, err
+	}
+	return value != 0, nil
+}
+
+// decodeCategorical decodes categorical objects. They store the code of each
+// element as unsigned integer and the names of all categories in a cell array.
+func decodeCategorical(s *Subsystem, dims Dim, objects []McosObject, depth int) (Dim, interface{}, error) {
+	var content Categorical
+
+	if len(objects) != 1 {
+		return nil, nil, fmt.Errorf("Expected a single categorical object, got %d", len(objects))
+	}
+	object := objects[0]
+
+	codes, err := s.property(object, "codes", depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	// MATLAB stores the codes as unsigned integers
+	switch int(codes.Class) {
+	case MxUint8Class, MxUint16Class, MxUint32Class, MxUint64Class:
+	default:
+		return nil, nil, fmt.Errorf("Expected unsigned integer codes, got class %d", codes.Class)
+	}
+	values, err := codes.uint64s()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names, err := s.property(object, "categoryNames", depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	if content.Categories, err = readCellStrings(names); err != nil {
+		return nil, nil, err
+	}
+	for _, code := range values {
+		if code > uint64(len(content.Categories)) {
+			return nil, nil, fmt.Errorf("Code %d exceeds %d categories", code, len(content.Categories))
+		}
+		content.Codes = append(content.Codes, int(code))
+	}
+
+	ordinal, err := s.property(object, "isOrdinal", depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	if content.IsOrdinal, err = readBool(ordinal); err != nil {
+		return nil, nil, err
+	}
+	protected, err := s.property(object, "isProtected", depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	if content.IsProtected, err = readBool(protected); err != nil {
+		return nil, nil, err
+	}
+
+	return codes.Dim, content, nil
+}
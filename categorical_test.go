@@ -0,0 +1,68 @@
+package matf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCategorical(t *testing.T) {
+	fixture := mcosFixture{
+		names:   []string{"codes", "categoryNames", "isProtected", "isOrdinal", "categorical"},
+		classes: [][2]uint32{{0, 5}},
+		objects: [][]uint32{
+			{1, 1, 1, 0, 2, 1, 1, 3, 2, 0, 4, 2, 1},
+		},
+		cells: []MatMatrix{
+			{Class: uint32(MxUint8Class), Dim: Dim{2, 2}, Content: NumPrt{RealPart: []interface{}{uint8(1), uint8(0), uint8(2), uint8(1)}}},
+			cellStrings("low", "high"),
+		},
+	}
+	elements := readMcosFile(t, []MatMatrix{
+		{Name: "c", Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "categorical", Metadata: mcosRef(1, []uint32{1, 1}, 1)}},
+	}, fixture)
+
+	expected := Categorical{Codes: []int{1, 0, 2, 1}, Categories: []string{"low", "high"}, IsOrdinal: true}
+	if !reflect.DeepEqual(elements[0].Content, expected) || !reflect.DeepEqual(elements[0].Dim, Dim{2, 2}) {
+		t.Fatalf("Expected %#v, got: %v %#v", expected, elements[0].Dim, elements[0].Content)
+	}
+}
+
+func TestDecodeCategoricalErrors(t *testing.T) {
+	t.Parallel()
+
+	valid := map[string]MatMatrix{
+		"codes":         {Class: uint32(MxUint8Class), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []interface{}{uint8(1)}}},
+		"categoryNames": cellStrings("a"),
+		"isOrdinal":     {Class: uint32(MxUint8Class), Flags: FlagLogical, Dim: Dim{1, 1}, Content: NumPrt{RealPart: []interface{}{uint8(0)}}},
+		"isProtected":   {Class: uint32(MxUint8Class), Flags: FlagLogical, Dim: Dim{1, 1}, Content: NumPrt{RealPart: []interface{}{uint8(0)}}},
+	}
+	invalid := func(name string, value MatMatrix) map[string]MatMatrix {
+		properties := make(map[string]MatMatrix)
+		for k, v := range valid {
+			properties[k] = v
+		}
+		properties[name] = value
+		return properties
+	}
+
+	tests := []struct {
+		name       string
+		properties map[string]MatMatrix
+		err        bool
+	}{
+		{name: "Valid", properties: valid},
+		{name: "Codes", properties: invalid("codes", doubles(1)), err: true},
+		{name: "CodeRange", properties: invalid("codes", MatMatrix{Class: uint32(MxUint8Class), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []interface{}{uint8(2)}}}), err: true},
+		{name: "Categories", properties: invalid("categoryNames", doubles(1)), err: true},
+		{name: "Ordinal", properties: invalid("isOrdinal", cellStrings("a")), err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := decodeCategorical(&Subsystem{}, nil, []McosObject{{Class: McosClass{Name: "categorical"}, Properties: tc.properties}}, 0)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+		})
+	}
+}
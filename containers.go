@@ -0,0 +1,135 @@
+package matf
+
+import (
+	"fmt"
+)
+
+// ContainersMap represents a MATLAB containers.Map object
+type ContainersMap struct {
+	KeyType   string                // Type of the keys, like char or double.
+	ValueType string                // Type of the values, like any or double.
+	Strings   map[string]MatMatrix  // Values of a map with char keys.
+	Numbers   map[float64]MatMatrix // Values of a map with double, single, int32 or uint32 keys.
+	Integers  map[int64]MatMatrix   // Values of a map with int64 keys.
+	Unsigned  map[uint64]MatMatrix  // Values of a map with uint64 keys.
+}
+
+// readCells returns the cells of a cell array
+func readCells(mat MatMatrix) ([]MatMatrix, error) {
+	switch content := mat.Content.(type) {
+	case CellPrt:
+		return content.Cells, nil
+	case NumPrt:
+		// Empty arrays are stored as double
+		if mat.NumElements() == 0 {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("Expected cell array, got %T", mat.Content)
+}
+
+// serializedField returns a field of the serialization struct of a map
+func serializedField(content StructPrt, name string) (MatMatrix, error) {
+	values, ok := lookupField(content, name)
+	if !ok || len(values) != 1 {
+		return MatMatrix{}, fmt.Errorf("Field %s is missing", name)
+	}
+	value, ok := values[0].(MatMatrix)
+	if !ok {
+		return MatMatrix{}, fmt.Errorf("Unexpected field %s: %T", name, values[0])
+	}
+	return value, nil
+}
+
+// decodeContainersMap decodes containers.Map objects. They serialize their
+// keys and values into two cell arrays of the same size.
+func decodeContainersMap(s *Subsystem, dims Dim, objects []McosObject, depth int) (Dim, interface{}, error) {
+	var content ContainersMap
+
+	if len(objects) != 1 {
+		return nil, nil, fmt.Errorf("Expected a single containers.Map object, got %d", len(objects))
+	}
+	serialization, err := s.property(objects[0], "serialization", depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields, ok := serialization.Content.(StructPrt)
+	if !ok {
+		return nil, nil, fmt.Errorf("Expected serialization struct, got %T", serialization.Content)
+	}
+
+	var matrices = make(map[string]MatMatrix)
+	for _, name := range []string{"keys", "values", "keyType", "valueType"} {
+		if matrices[name], err = serializedField(fields, name); err != nil {
+			return nil, nil, err
+		}
+	}
+	if content.KeyType, err = readString(matrices["keyType"]); err != nil {
+		return nil, nil, err
+	}
+	if content.ValueType, err = readString(matrices["valueType"]); err != nil {
+		return nil, nil, err
+	}
+
+	keys, err := readCells(matrices["keys"])
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := readCells(matrices["values"])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(keys) != len(values) {
+		return nil, nil, fmt.Errorf("Map contains %d keys for %d values", len(keys), len(values))
+	}
+
+	switch content.KeyType {
+	case "char":
+		content.Strings = make(map[string]MatMatrix)
+		for i, key := range keys {
+			name, err := readString(key)
+			if err != nil {
+				return nil, nil, err
+			}
+			content.Strings[name] = values[i]
+		}
+	case "double", "single", "int32", "uint32":
+		content.Numbers = make(map[float64]MatMatrix)
+		for i, key := range keys {
+			number, err := readScalar(key)
+			if err != nil {
+				return nil, nil, err
+			}
+			content.Numbers[number] = values[i]
+		}
+	case "int64":
+		// Not every int64 can be represented exactly as float64
+		content.Integers = make(map[int64]MatMatrix)
+		for i, key := range keys {
+			numbers, err := key.Int64s()
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(numbers) != 1 {
+				return nil, nil, fmt.Errorf("Expected numeric scalar, got %d elements", len(numbers))
+			}
+			content.Integers[numbers[0]] = values[i]
+		}
+	case "uint64":
+		content.Unsigned = make(map[uint64]MatMatrix)
+		for i, key := range keys {
+			numbers, err := key.uint64s()
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(numbers) != 1 {
+				return nil, nil, fmt.Errorf("Expected numeric scalar, got %d elements", len(numbers))
+			}
+			content.Unsigned[numbers[0]] = values[i]
+		}
+	default:
+		return nil, nil, fmt.Errorf("Unsupported key type: %s", content.KeyType)
+	}
+
+	return dims, content, nil
+}
@@ -0,0 +1,132 @@
+package matf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func serialization(keyType string, keys, values MatMatrix) MatMatrix {
+	return MatMatrix{Class: uint32(MxStructClass), Dim: Dim{1, 1}, Content: StructPrt{
+		FieldNames: []string{"keys", "values", "uniformity", "keyType", "valueType"},
+		FieldValues: map[string][]interface{}{
+			"keys":       {keys},
+			"values":     {values},
+			"uniformity": {MatMatrix{Class: uint32(MxUint8Class), Flags: FlagLogical, Dim: Dim{1, 1}, Content: NumPrt{RealPart: []interface{}{uint8(0)}}}},
+			"keyType":    {chars(keyType)},
+			"valueType":  {chars("any")},
+		}}}
+}
+
+func TestDecodeContainersMap(t *testing.T) {
+	numbers := MatMatrix{Class: uint32(MxCellClass), Dim: Dim{1, 2}, Content: CellPrt{Cells: []MatMatrix{doubles(1), doubles(2.5)}}}
+	fixture := mcosFixture{
+		names:   []string{"serialization", "containers", "Map", "any", "string"},
+		classes: [][2]uint32{{2, 3}, {0, 5}},
+		objects: [][]uint32{
+			{1, 1, 1, 0},
+			{1, 1, 1, 1},
+			{2, 4, 1, 2},
+		},
+		cells: []MatMatrix{
+			serialization("char", cellStrings("a", "b"), MatMatrix{Class: uint32(MxCellClass), Dim: Dim{1, 2}, Content: CellPrt{Cells: []MatMatrix{doubles(1), mcosRef(2, []uint32{1, 1}, 3)}}}),
+			serialization("double", numbers, cellStrings("x", "y")),
+			packStrings([]uint64{1, 1}, "z"),
+		},
+	}
+	elements := readMcosFile(t, []MatMatrix{
+		{Name: "s", Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "containers.Map", Metadata: mcosRef(1, []uint32{1, 1}, 1)}},
+		{Name: "n", Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "containers.Map", Metadata: mcosRef(1, []uint32{1, 1}, 2)}},
+	}, fixture)
+
+	strs, ok := elements[0].Content.(ContainersMap)
+	if !ok {
+		t.Fatalf("Expected ContainersMap, got: %#v", elements[0].Content)
+	}
+	if strs.KeyType != "char" || strs.ValueType != "any" || len(strs.Strings) != 2 || strs.Numbers != nil {
+		t.Fatalf("Unexpected map: %#v", strs)
+	}
+	if !reflect.DeepEqual(strs.Strings["b"].Content, StringPrt{Strings: []string{"z"}}) {
+		t.Fatalf("Unexpected value of b: %#v", strs.Strings["b"])
+	}
+
+	nums, ok := elements[1].Content.(ContainersMap)
+	if !ok {
+		t.Fatalf("Expected ContainersMap, got: %#v", elements[1].Content)
+	}
+	if nums.KeyType != "double" || len(nums.Numbers) != 2 || nums.Strings != nil {
+		t.Fatalf("Unexpected map: %#v", nums)
+	}
+	if !reflect.DeepEqual(nums.Numbers[2.5].Content, CharPrt{Chars: []string{"y"}}) {
+		t.Fatalf("Unexpected value of 2.5: %#v", nums.Numbers[2.5])
+	}
+}
+
+func TestDecodeContainersMapIntegers(t *testing.T) {
+	t.Parallel()
+
+	signed := MatMatrix{Class: uint32(MxInt64Class), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []int64{1<<53 + 1}}}
+	unsigned := MatMatrix{Class: uint32(MxUint64Class), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []uint64{1<<64 - 1}}}
+	cells := func(cells ...MatMatrix) MatMatrix {
+		return MatMatrix{Class: uint32(MxCellClass), Dim: Dim{1, len(cells)}, Content: CellPrt{Cells: cells}}
+	}
+	decode := func(keyType string, keys, values MatMatrix) (ContainersMap, error) {
+		object := McosObject{Class: McosClass{Namespace: "containers", Name: "Map"}, Properties: map[string]MatMatrix{
+			"serialization": serialization(keyType, keys, values),
+		}}
+		_, content, err := decodeContainersMap(&Subsystem{}, Dim{1, 1}, []McosObject{object}, 0)
+		if err != nil {
+			return ContainersMap{}, err
+		}
+		return content.(ContainersMap), nil
+	}
+
+	integers, err := decode("int64", cells(signed), cellStrings("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := integers.Integers[1<<53+1]; !ok || len(integers.Integers) != 1 || integers.Numbers != nil {
+		t.Fatalf("Unexpected map: %#v", integers)
+	}
+	// 2^64-1 is out of the range of int64
+	if _, err := decode("int64", cells(signed, unsigned), cellStrings("a", "b")); err == nil {
+		t.Fatalf("Expected error for key 2^64-1 of an int64 map, got none")
+	}
+
+	unsigneds, err := decode("uint64", cells(signed, unsigned), cellStrings("a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := unsigneds.Unsigned[1<<53+1]; !ok || len(unsigneds.Unsigned) != 2 {
+		t.Fatalf("Unexpected map: %#v", unsigneds)
+	}
+	if !reflect.DeepEqual(unsigneds.Unsigned[1<<64-1].Content, CharPrt{Chars: []string{"b"}}) {
+		t.Fatalf("Unexpected value of 2^64-1: %#v", unsigneds.Unsigned[1<<64-1])
+	}
+}
+
+func TestDecodeContainersMapErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		value MatMatrix
+		err   bool
+	}{
+		{name: "Valid", value: serialization("char", cellStrings("a"), cellStrings("b"))},
+		{name: "Empty", value: serialization("char", doubles(), doubles())},
+		{name: "NoStruct", value: doubles(1), err: true},
+		{name: "Size", value: serialization("char", cellStrings("a", "b"), cellStrings("c")), err: true},
+		{name: "KeyType", value: serialization("logical", cellStrings("a"), cellStrings("b")), err: true},
+		{name: "Keys", value: serialization("double", cellStrings("a"), cellStrings("b")), err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			object := McosObject{Class: McosClass{Namespace: "containers", Name: "Map"}, Properties: map[string]MatMatrix{"serialization": tc.value}}
+			_, _, err := decodeContainersMap(&Subsystem{}, Dim{1, 1}, []McosObject{object}, 0)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+		})
+	}
+}
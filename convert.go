@@ -0,0 +1,390 @@
+package matf
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// maxExactInteger is the largest integer, up to which all integers can be
+// represented exactly by a float64.
+const maxExactInteger = 1 << 53
+
+// numericSlice checks, that values is a slice, and returns it
+func numericSlice(values interface{}) (reflect.Value, error) {
+	t := reflect.ValueOf(values)
+	if values != nil && t.Kind() != reflect.Slice {
+		return t, fmt.Errorf("Expected slice of numeric values, got %T", values)
+	}
+	return t, nil
+}
+
+// numericElement returns the element i of a slice. Elements of a
+// []interface{} are unwrapped.
+func numericElement(t reflect.Value, i int) reflect.Value {
+	value := t.Index(i)
+	if value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	return value
+}
+
+// number is a single numeric value. Integers keep their exact value.
+type number struct {
+	isFloat  bool    // Set for floating-point values, that are stored in f.
+	negative bool    // Set for negative integers, that are stored in i.
+	f        float64 // Value of floating-point values.
+	i        int64   // Value of negative integers.
+	u        uint64  // Value of other integers and bools.
+}
+
+// value returns the number in the representation, it is stored in
+func (n number) value() interface{} {
+	switch {
+	case n.isFloat:
+		return n.f
+	case n.negative:
+		return n.i
+	}
+	return n.u
+}
+
+// eachNumber calls convert for each value of the slice t
+func eachNumber(t reflect.Value, convert func(i int, n number) error) error {
+	for i := 0; i < t.Len(); i++ {
+		var n number
+		value := numericElement(t, i)
+		switch value.Kind() {
+		case reflect.Float32, reflect.Float64:
+			n.isFloat, n.f = true, value.Float()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if value.Int() < 0 {
+				n.negative, n.i = true, value.Int()
+			} else {
+				n.u = uint64(value.Int())
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n.u = value.Uint()
+		case reflect.Bool:
+			if value.Bool() {
+				n.u = 1
+			}
+		default:
+			return fmt.Errorf("Value of type %v at %d is not numeric", value.Kind(), i)
+		}
+		if err := convert(i, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// float64s converts values to float64. Integers beyond 2^53 can not be
+// represented exactly and return an error.
+func float64s(values interface{}) ([]float64, error) {
+	if floats, ok := values.([]float64); ok {
+		return floats, nil
+	}
+	t, err := numericSlice(values)
+	if err != nil || values == nil {
+		return nil, err
+	}
+	floats := make([]float64, t.Len())
+	err = eachNumber(t, func(i int, n number) error {
+		switch {
+		case n.isFloat:
+			floats[i] = n.f
+		case n.negative && n.i >= -maxExactInteger:
+			floats[i] = float64(n.i)
+		case !n.negative && n.u <= maxExactInteger:
+			floats[i] = float64(n.u)
+		default:
+			return fmt.Errorf("Value %v at %d can not be represented exactly as float64", n.value(), i)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return floats, nil
+}
+
+// int64s converts values to int64. Floating-point values need to be integers
+// within the range of int64.
+func int64s(values interface{}) ([]int64, error) {
+	if ints, ok := values.([]int64); ok {
+		return ints, nil
+	}
+	t, err := numericSlice(values)
+	if err != nil || values == nil {
+		return nil, err
+	}
+	ints := make([]int64, t.Len())
+	err = eachNumber(t, func(i int, n number) error {
+		switch {
+		// float64(math.MaxInt64) is rounded up to 2^63, which does not fit
+		case n.isFloat && n.f == math.Trunc(n.f) && n.f >= math.MinInt64 && n.f < math.MaxInt64:
+			ints[i] = int64(n.f)
+		case n.negative:
+			ints[i] = n.i
+		case !n.isFloat && n.u <= math.MaxInt64:
+			ints[i] = int64(n.u)
+		default:
+			return fmt.Errorf("Value %v at %d can not be represented exactly as int64", n.value(), i)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ints, nil
+}
+
+// uint64s converts values to uint64. Floating-point values need to be
+// integers within the range of uint64.
+func uint64s(values interface{}) ([]uint64, error) {
+	if ints, ok := values.([]uint64); ok {
+		return ints, nil
+	}
+	t, err := numericSlice(values)
+	if err != nil || values == nil {
+		return nil, err
+	}
+	ints := make([]uint64, t.Len())
+	err = eachNumber(t, func(i int, n number) error {
+		switch {
+		// float64(math.MaxUint64) is rounded up to 2^64, which does not fit
+		case n.isFloat && n.f == math.Trunc(n.f) && n.f >= 0 && n.f < math.MaxUint64:
+			ints[i] = uint64(n.f)
+		case !n.isFloat && !n.negative:
+			ints[i] = n.u
+		default:
+			return fmt.Errorf("Value %v at %d can not be represented exactly as uint64", n.value(), i)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ints, nil
+}
+
+// ints converts values, like indices or dimensions, to int
+func ints(values interface{}) ([]int, error) {
+	ints64, err := int64s(values)
+	if err != nil {
+		return nil, err
+	}
+	var ints []int
+	if ints64 != nil {
+		ints = make([]int, len(ints64))
+	}
+	for i, v := range ints64 {
+		if int64(int(v)) != v {
+			return nil, fmt.Errorf("Value %d at %d exceeds the range of int", v, i)
+		}
+		ints[i] = int(v)
+	}
+	return ints, nil
+}
+
+// bools converts values to bool. Numeric values need to be either 0 or 1.
+func bools(values interface{}) ([]bool, error) {
+	if logicals, ok := values.([]bool); ok {
+		return logicals, nil
+	}
+	floats, err := float64s(values)
+	if err != nil {
+		return nil, err
+	}
+	var logicals []bool
+	if floats != nil {
+		logicals = make([]bool, len(floats))
+	}
+	for i, f := range floats {
+		if f != 0 && f != 1 {
+			return nil, fmt.Errorf("Value %v at %d can not be represented exactly as bool", f, i)
+		}
+		logicals[i] = f == 1
+	}
+	return logicals, nil
+}
+
+// checkReal returns an error, if the imaginary part contains a nonzero value,
+// that would be lost in the conversion of the real part.
+func checkReal(imaginaryPart interface{}) error {
+	imaginary, err := float64s(imaginaryPart)
+	if err != nil {
+		return err
+	}
+	for i, f := range imaginary {
+		if f != 0 {
+			return fmt.Errorf("Imaginary part %v at %d would be lost", f, i)
+		}
+	}
+	return nil
+}
+
+// Float64s returns the real part as float64, independent of the data type, it
+// is stored in. It returns an error, if a value can not be represented
+// exactly or if the imaginary part is not zero. If RealPart already is a
+// []float64, it is returned without a copy.
+func (n NumPrt) Float64s() ([]float64, error) {
+	if err := checkReal(n.ImaginaryPart); err != nil {
+		return nil, err
+	}
+	return float64s(n.RealPart)
+}
+
+// Int64s returns the real part as int64. It returns an error, if a value is
+// not an integer within the range of int64 or if the imaginary part is not
+// zero.
+func (n NumPrt) Int64s() ([]int64, error) {
+	if err := checkReal(n.ImaginaryPart); err != nil {
+		return nil, err
+	}
+	return int64s(n.RealPart)
+}
+
+// Bools returns the real part as bool, like it is stored for logical arrays.
+// It returns an error, if a value is neither 0 nor 1 or if the imaginary part
+// is not zero.
+func (n NumPrt) Bools() ([]bool, error) {
+	if err := checkReal(n.ImaginaryPart); err != nil {
+		return nil, err
+	}
+	return bools(n.RealPart)
+}
+
+// Complex128s pairs the real part and the imaginary part. Without an
+// imaginary part, the imaginary part of each value is zero.
+func (n NumPrt) Complex128s() ([]complex128, error) {
+	realPart, imaginaryPart, err := splitComplex(n.RealPart, n.ImaginaryPart)
+	if err != nil {
+		return nil, err
+	}
+	re, err := float64s(realPart)
+	if err != nil {
+		return nil, err
+	}
+	im, err := float64s(imaginaryPart)
+	if err != nil {
+		return nil, err
+	}
+	if imaginaryPart != nil && len(im) != len(re) {
+		return nil, fmt.Errorf("Real part has %d values, imaginary part %d", len(re), len(im))
+	}
+	var values []complex128
+	if re != nil {
+		values = make([]complex128, len(re))
+	}
+	for i := range values {
+		if im != nil {
+			values[i] = complex(re[i], im[i])
+		} else {
+			values[i] = complex(re[i], 0)
+		}
+	}
+	return values, nil
+}
+
+// Complex64s pairs the real part and the imaginary part like Complex128s(),
+// as it is done for single arrays. It returns an error, if a value can not
+// be represented exactly as float32.
+func (n NumPrt) Complex64s() ([]complex64, error) {
+	values, err := n.Complex128s()
+	if err != nil {
+		return nil, err
+	}
+	var singles []complex64
+	if values != nil {
+		singles = make([]complex64, len(values))
+	}
+	for i, value := range values {
+		singles[i] = complex64(value)
+		if !exactSingle(real(value)) || !exactSingle(imag(value)) {
+			return nil, fmt.Errorf("Value %v at %d can not be represented exactly as complex64", value, i)
+		}
+	}
+	return singles, nil
+}
+
+// exactSingle reports, whether f can be represented exactly as float32
+func exactSingle(f float64) bool {
+	return math.IsNaN(f) || float64(float32(f)) == f
+}
+
+// numeric returns the content of a numeric matrix
+func (m MatMatrix) numeric() (NumPrt, error) {
+	content, ok := m.Content.(NumPrt)
+	if !ok {
+		return NumPrt{}, fmt.Errorf("Expected numeric array, got %T", m.Content)
+	}
+	return content, nil
+}
+
+// uint64s returns the real part of a numeric matrix as uint64, see
+// uint64s().
+func (m MatMatrix) uint64s() ([]uint64, error) {
+	content, err := m.numeric()
+	if err != nil {
+		return nil, err
+	}
+	return uint64s(content.RealPart)
+}
+
+// Float64s returns the values of a numeric matrix as float64, see
+// NumPrt.Float64s().
+func (m MatMatrix) Float64s() ([]float64, error) {
+	content, err := m.numeric()
+	if err != nil {
+		return nil, err
+	}
+	return content.Float64s()
+}
+
+// Int64s returns the values of a numeric matrix as int64, see
+// NumPrt.Int64s().
+func (m MatMatrix) Int64s() ([]int64, error) {
+	content, err := m.numeric()
+	if err != nil {
+		return nil, err
+	}
+	return content.Int64s()
+}
+
+// Bools returns the values of a numeric or logical matrix as bool, see
+// NumPrt.Bools().
+func (m MatMatrix) Bools() ([]bool, error) {
+	content, err := m.numeric()
+	if err != nil {
+		return nil, err
+	}
+	return content.Bools()
+}
+
+// Complex128s returns the values of a numeric matrix as complex128, see
+// NumPrt.Complex128s().
+func (m MatMatrix) Complex128s() ([]complex128, error) {
+	content, err := m.numeric()
+	if err != nil {
+		return nil, err
+	}
+	return content.Complex128s()
+}
+
+// Complex64s returns the values of a numeric matrix as complex64, see
+// NumPrt.Complex64s().
+func (m MatMatrix) Complex64s() ([]complex64, error) {
+	content, err := m.numeric()
+	if err != nil {
+		return nil, err
+	}
+	return content.Complex64s()
+}
+
+// Strings returns the rows of a char array, the elements of a string array or
+// the content of a cell array of character vectors.
+func (m MatMatrix) Strings() ([]string, error) {
+	return readCellStrings(m)
+}
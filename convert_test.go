@@ -0,0 +1,258 @@
+package matf
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFloat64s(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content NumPrt
+		values  []float64
+		err     bool
+	}{
+		{name: "Double", content: NumPrt{RealPart: []float64{1.5, -2}}, values: []float64{1.5, -2}},
+		{name: "Uint8", content: NumPrt{RealPart: []uint8{0, 255}}, values: []float64{0, 255}},
+		{name: "Single", content: NumPrt{RealPart: []float32{0.5}}, values: []float64{0.5}},
+		{name: "Interface", content: NumPrt{RealPart: []interface{}{int16(-3), 4.0}}, values: []float64{-3, 4}},
+		{name: "Empty", content: NumPrt{}},
+		{name: "ZeroImaginary", content: NumPrt{RealPart: []int32{7}, ImaginaryPart: []int32{0}}, values: []float64{7}},
+		{name: "Imaginary", content: NumPrt{RealPart: []int32{7}, ImaginaryPart: []int32{1}}, err: true},
+		{name: "LargeInt64", content: NumPrt{RealPart: []int64{1<<53 + 1}}, err: true},
+		{name: "LargeUint64", content: NumPrt{RealPart: []uint64{1<<64 - 1}}, err: true},
+		{name: "NotNumeric", content: NumPrt{RealPart: []string{"1"}}, err: true},
+		{name: "NoSlice", content: NumPrt{RealPart: 1.0}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := tc.content.Float64s()
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(values, tc.values) {
+				t.Fatalf("Expected: %v\tGot: %v", tc.values, values)
+			}
+		})
+	}
+}
+
+func TestInt64s(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content NumPrt
+		values  []int64
+		err     bool
+	}{
+		{name: "Double", content: NumPrt{RealPart: []float64{3, -4}}, values: []int64{3, -4}},
+		{name: "Int64", content: NumPrt{RealPart: []int64{-1 << 62}}, values: []int64{-1 << 62}},
+		{name: "Uint32", content: NumPrt{RealPart: []uint32{1<<32 - 1}}, values: []int64{1<<32 - 1}},
+		{name: "Fraction", content: NumPrt{RealPart: []float64{0.5}}, err: true},
+		{name: "NaN", content: NumPrt{RealPart: []float64{math.NaN()}}, err: true},
+		{name: "Overflow", content: NumPrt{RealPart: []float64{1 << 63}}, err: true},
+		{name: "LargeUint64", content: NumPrt{RealPart: []uint64{1 << 63}}, err: true},
+		{name: "Imaginary", content: NumPrt{RealPart: []float64{1}, ImaginaryPart: []float64{2}}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := tc.content.Int64s()
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(values, tc.values) {
+				t.Fatalf("Expected: %v\tGot: %v", tc.values, values)
+			}
+		})
+	}
+}
+
+func TestUint64s(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		values interface{}
+		ints   []uint64
+		err    bool
+	}{
+		{name: "Uint64", values: []uint64{1<<64 - 1}, ints: []uint64{1<<64 - 1}},
+		{name: "Int8", values: []int8{0, 127}, ints: []uint64{0, 127}},
+		{name: "Double", values: []float64{1 << 63}, ints: []uint64{1 << 63}},
+		{name: "Interface", values: []interface{}{uint16(1), true}, ints: []uint64{1, 1}},
+		{name: "Negative", values: []int32{-1}, err: true},
+		{name: "Fraction", values: []float32{0.5}, err: true},
+		{name: "Overflow", values: []float64{1 << 64}, err: true},
+		{name: "NotNumeric", values: []string{"1"}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := uint64s(tc.values)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(values, tc.ints) {
+				t.Fatalf("Expected: %v\tGot: %v", tc.ints, values)
+			}
+		})
+	}
+}
+
+func TestInts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		values interface{}
+		ints   []int
+		err    bool
+	}{
+		{name: "Uint16", values: []uint16{0, 1<<16 - 1}, ints: []int{0, 1<<16 - 1}},
+		{name: "Int16", values: []int16{-1, 2}, ints: []int{-1, 2}},
+		{name: "Double", values: []float64{3}, ints: []int{3}},
+		{name: "Empty", values: []uint8{}, ints: []int{}},
+		{name: "Fraction", values: []float64{1.5}, err: true},
+		{name: "LargeUint64", values: []uint64{1 << 63}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := ints(tc.values)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(values, tc.ints) {
+				t.Fatalf("Expected: %v\tGot: %v", tc.ints, values)
+			}
+		})
+	}
+}
+
+func TestBools(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content NumPrt
+		values  []bool
+		err     bool
+	}{
+		{name: "Logical", content: NumPrt{RealPart: []uint8{1, 0}}, values: []bool{true, false}},
+		{name: "Bool", content: NumPrt{RealPart: []bool{false}}, values: []bool{false}},
+		{name: "Double", content: NumPrt{RealPart: []float64{0, 1}}, values: []bool{false, true}},
+		{name: "Two", content: NumPrt{RealPart: []uint8{2}}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := tc.content.Bools()
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(values, tc.values) {
+				t.Fatalf("Expected: %v\tGot: %v", tc.values, values)
+			}
+		})
+	}
+}
+
+func TestComplex128s(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content NumPrt
+		values  []complex128
+		err     bool
+	}{
+		{name: "Complex", content: NumPrt{RealPart: []float64{1, 2}, ImaginaryPart: []float64{3, -4}}, values: []complex128{1 + 3i, 2 - 4i}},
+		{name: "Int16", content: NumPrt{RealPart: []int16{1}, ImaginaryPart: []int16{-1}}, values: []complex128{1 - 1i}},
+		{name: "Real", content: NumPrt{RealPart: []float32{5}}, values: []complex128{5}},
+		{name: "Mismatch", content: NumPrt{RealPart: []float64{1, 2}, ImaginaryPart: []float64{3}}, err: true},
+		{name: "Complex128", content: NumPrt{RealPart: []complex128{1 - 2i}}, values: []complex128{1 - 2i}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := tc.content.Complex128s()
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(values, tc.values) {
+				t.Fatalf("Expected: %v\tGot: %v", tc.values, values)
+			}
+		})
+	}
+}
+
+func TestComplex64s(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content NumPrt
+		values  []complex64
+		err     bool
+	}{
+		{name: "Single", content: NumPrt{RealPart: []float32{1, 0.5}, ImaginaryPart: []float32{-1, 2}}, values: []complex64{1 - 1i, 0.5 + 2i}},
+		{name: "Complex64", content: NumPrt{RealPart: []complex64{3 + 4i}}, values: []complex64{3 + 4i}},
+		{name: "ExactDouble", content: NumPrt{RealPart: []float64{0.25}, ImaginaryPart: []float64{8}}, values: []complex64{0.25 + 8i}},
+		{name: "Double", content: NumPrt{RealPart: []float64{0.1}, ImaginaryPart: []float64{0}}, err: true},
+		{name: "ImaginaryPart", content: NumPrt{RealPart: []complex64{1}, ImaginaryPart: []float32{1}}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := tc.content.Complex64s()
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(values, tc.values) {
+				t.Fatalf("Expected: %v\tGot: %v", tc.values, values)
+			}
+		})
+	}
+}
+
+func TestMatMatrixAccessors(t *testing.T) {
+	t.Parallel()
+
+	numeric := MatMatrix{Class: uint32(MxInt8Class), Dim: Dim{1, 2}, Content: NumPrt{RealPart: []int8{1, -1}}}
+	if values, err := numeric.Float64s(); err != nil || !reflect.DeepEqual(values, []float64{1, -1}) {
+		t.Fatalf("Unexpected float64 values: %v %v", values, err)
+	}
+	if values, err := numeric.Int64s(); err != nil || !reflect.DeepEqual(values, []int64{1, -1}) {
+		t.Fatalf("Unexpected int64 values: %v %v", values, err)
+	}
+	if values, err := numeric.Complex128s(); err != nil || !reflect.DeepEqual(values, []complex128{1, -1}) {
+		t.Fatalf("Unexpected complex128 values: %v %v", values, err)
+	}
+	if _, err := numeric.Bools(); err == nil {
+		t.Fatalf("Expected error for -1 as bool, got none")
+	}
+	if _, err := numeric.Strings(); err == nil {
+		t.Fatalf("Expected error for strings of a numeric array, got none")
+	}
+
+	chars := MatMatrix{Class: uint32(MxCharClass), Dim: Dim{2, 2}, Content: CharPrt{Chars: []string{"ab", "cd"}}}
+	if strs, err := chars.Strings(); err != nil || !reflect.DeepEqual(strs, []string{"ab", "cd"}) {
+		t.Fatalf("Unexpected strings: %v %v", strs, err)
+	}
+	if _, err := chars.Float64s(); err == nil {
+		t.Fatalf("Expected error for float64 values of a char array, got none")
+	}
+	cell := MatMatrix{Class: uint32(MxCellClass), Dim: Dim{1, 2}, Content: CellPrt{Cells: []MatMatrix{
+		{Class: uint32(MxCharClass), Dim: Dim{1, 1}, Content: CharPrt{Chars: []string{"x"}}},
+		{Class: uint32(MxCharClass), Dim: Dim{1, 2}, Content: CharPrt{Chars: []string{"yz"}}},
+	}}}
+	if strs, err := cell.Strings(); err != nil || !reflect.DeepEqual(strs, []string{"x", "yz"}) {
+		t.Fatalf("Unexpected strings: %v %v", strs, err)
+	}
+}
@@ -1,10 +1,12 @@
 package matf
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"math"
+	"reflect"
 
 	"github.com/pkg/errors"
 )
@@ -45,68 +47,175 @@ const (
 	MxUint32Class int = 13
 	MxInt64Class  int = 14
 	MxUint64Class int = 15
+	MxOpaqueClass int = 17 // Undocumented class, used for MCOS objects like string or table.
 )
 
 func extractDataElement(r io.Reader, order binary.ByteOrder, dataType, numberOfBytes int) (interface{}, int, error) {
-	var element interface{}
-	var elements []interface{}
-	var err error
-	var data []byte
-	var i int
-
 	if dataType == MiMatrix {
-		element, i, err = extractMatrix(r, order)
+		element, i, err := extractMatrix(r, order)
 		if err != nil {
 			return nil, 0, errors.Wrap(err, "\nextractMatrix() in extractDataElement() failed")
 		}
 		return element, i, nil
 	}
 
-	data, err = readMatfBytes(r, order, numberOfBytes)
-
+	data, err := readMatfBytes(r, order, numberOfBytes)
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "\nreadMatfBytes() in extractDataElement() failed")
 	}
-	for i < numberOfBytes {
-		switch dataType {
-		case MiInt8:
-			element = int8(data[i])
-			i++
-		case MiUint8:
-			element = uint8(data[i])
-			i++
-		case MiInt16:
-			element = int16(order.Uint16(data[i : i+2]))
-			i += 2
-		case MiUint16:
-			element = order.Uint16(data[i : i+2])
-			i += 2
-		case MiInt32:
-			element = int32(order.Uint32(data[i : i+4]))
-			i += 4
-		case MiUint32:
-			element = order.Uint32(data[i : i+4])
-			i += 4
-		case MiSingle:
-			bits := order.Uint32(data[i : i+4])
-			element = math.Float32frombits(bits)
-			i += 4
-		case MiInt64:
-			element = int64(order.Uint64(data[i : i+8]))
-			i += 8
-		case MiUint64:
-			element = order.Uint64(data[i : i+8])
-			i += 8
-		case MiDouble:
-			bits := order.Uint64(data[i : i+8])
-			element = math.Float64frombits(bits)
-			i += 8
-		default:
-			return nil, 0, fmt.Errorf("Data Type %d is not supported", dataType)
-		}
-		elements = append(elements, element)
-	}
-	return elements, i, nil
+	elements, err := decodeValues(order, dataType, data)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "\ndecodeValues() in extractDataElement() failed")
+	}
+	return elements, numberOfBytes, nil
+}
+
+// decodeValues decodes data of a numeric dataType in bulk into a slice of
+// the matching Go type, like []float64 for MiDouble. Trailing bytes, that do
+// not make up a complete value, are ignored.
+func decodeValues(order binary.ByteOrder, dataType int, data []byte) (interface{}, error) {
+	switch dataType {
+	case MiInt8:
+		values := make([]int8, len(data))
+		for i := range values {
+			values[i] = int8(data[i])
+		}
+		return values, nil
+	case MiUint8:
+		values := make([]uint8, len(data))
+		copy(values, data)
+		return values, nil
+	case MiInt16:
+		values := make([]int16, len(data)/2)
+		for i := range values {
+			values[i] = int16(order.Uint16(data[2*i:]))
+		}
+		return values, nil
+	case MiUint16:
+		values := make([]uint16, len(data)/2)
+		for i := range values {
+			values[i] = order.Uint16(data[2*i:])
+		}
+		return values, nil
+	case MiInt32:
+		values := make([]int32, len(data)/4)
+		for i := range values {
+			values[i] = int32(order.Uint32(data[4*i:]))
+		}
+		return values, nil
+	case MiUint32:
+		values := make([]uint32, len(data)/4)
+		for i := range values {
+			values[i] = order.Uint32(data[4*i:])
+		}
+		return values, nil
+	case MiSingle:
+		values := make([]float32, len(data)/4)
+		for i := range values {
+			values[i] = math.Float32frombits(order.Uint32(data[4*i:]))
+		}
+		return values, nil
+	case MiInt64:
+		values := make([]int64, len(data)/8)
+		for i := range values {
+			values[i] = int64(order.Uint64(data[8*i:]))
+		}
+		return values, nil
+	case MiUint64:
+		values := make([]uint64, len(data)/8)
+		for i := range values {
+			values[i] = order.Uint64(data[8*i:])
+		}
+		return values, nil
+	case MiDouble:
+		values := make([]float64, len(data)/8)
+		for i := range values {
+			values[i] = math.Float64frombits(order.Uint64(data[8*i:]))
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("Data Type %d is not supported", dataType)
+}
+
+// valueTypes maps the numeric data types to the Go type of their values, see
+// decodeValues().
+var valueTypes = map[int]reflect.Type{
+	MiInt8:   reflect.TypeOf(int8(0)),
+	MiUint8:  reflect.TypeOf(uint8(0)),
+	MiInt16:  reflect.TypeOf(int16(0)),
+	MiUint16: reflect.TypeOf(uint16(0)),
+	MiInt32:  reflect.TypeOf(int32(0)),
+	MiUint32: reflect.TypeOf(uint32(0)),
+	MiSingle: reflect.TypeOf(float32(0)),
+	MiInt64:  reflect.TypeOf(int64(0)),
+	MiUint64: reflect.TypeOf(uint64(0)),
+	MiDouble: reflect.TypeOf(float64(0)),
+}
+
+// valuesDataType returns the numeric data type of values, that were decoded
+// by decodeValues(). It returns 0 for other values.
+func valuesDataType(values interface{}) int {
+	t := reflect.TypeOf(values)
+	if t == nil || t.Kind() != reflect.Slice {
+		return 0
+	}
+	for dataType, valueType := range valueTypes {
+		if t.Elem() == valueType {
+			return dataType
+		}
+	}
+	return 0
+}
+
+// promoteValues converts values into a slice of the Go type of dataType.
+// MATLAB stores values in a smaller data type, if they fit into it, like
+// a double array with small integers as miUINT8. Values, that do not fit
+// into dataType, return an error.
+func promoteValues(values interface{}, dataType int) (interface{}, error) {
+	valueType, ok := valueTypes[dataType]
+	if values == nil || !ok || valuesDataType(values) == dataType {
+		return values, nil
+	}
+	var to reflect.Value
+	switch valueType.Kind() {
+	case reflect.Float32, reflect.Float64:
+		floats, err := float64s(values)
+		if err != nil {
+			return nil, err
+		}
+		to = reflect.MakeSlice(reflect.SliceOf(valueType), len(floats), len(floats))
+		for i, f := range floats {
+			if valueType.Kind() == reflect.Float32 && !exactSingle(f) {
+				return nil, fmt.Errorf("Value %v at %d can not be represented exactly as %v", f, i, valueType)
+			}
+			to.Index(i).SetFloat(f)
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		ints, err := int64s(values)
+		if err != nil {
+			return nil, err
+		}
+		to = reflect.MakeSlice(reflect.SliceOf(valueType), len(ints), len(ints))
+		for i, v := range ints {
+			if to.Index(i).OverflowInt(v) {
+				return nil, fmt.Errorf("Value %d at %d exceeds the range of %v", v, i, valueType)
+			}
+			to.Index(i).SetInt(v)
+		}
+	default:
+		ints, err := uint64s(values)
+		if err != nil {
+			return nil, err
+		}
+		to = reflect.MakeSlice(reflect.SliceOf(valueType), len(ints), len(ints))
+		for i, v := range ints {
+			if to.Index(i).OverflowUint(v) {
+				return nil, fmt.Errorf("Value %d at %d exceeds the range of %v", v, i, valueType)
+			}
+			to.Index(i).SetUint(v)
+		}
+	}
+	return to.Interface(), nil
 }
 
 func extractNumeric(r io.Reader, order binary.ByteOrder) (interface{}, int, error) {
@@ -114,6 +223,10 @@ func extractNumeric(r io.Reader, order binary.ByteOrder) (interface{}, int, erro
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "\nextractTag() in extractNumeric() failed")
 	}
+	// Empty arrays do not have any values
+	if numberOfBytes == 0 {
+		return nil, 0, nil
+	}
 
 	re, _, err := extractDataElement(r, order, int(dataType), int(numberOfBytes))
 	if err != nil {
@@ -157,6 +270,85 @@ func extractArrayName(r io.Reader, order binary.ByteOrder) (string, int, error)
 	return string(arrayName), offset + int(numberOfBytes), nil
 }
 
+// charRows splits characters, which are stored column by column, into rows.
+// All further dimensions are appended to the columns. It returns an error, if
+// the dimensions do not match the number of characters. Empty arrays have no
+// rows.
+func charRows(chars []rune, dim Dim) ([]string, error) {
+	var strs []string
+	empty := len(dim) == 0
+	for _, size := range dim {
+		if size < 0 {
+			return nil, fmt.Errorf("Invalid dimensions %v", dim)
+		}
+		empty = empty || size == 0
+	}
+	if empty {
+		if len(chars) != 0 {
+			return nil, fmt.Errorf("Dimensions %v do not match %d characters", dim, len(chars))
+		}
+		return strs, nil
+	}
+	elements := 1
+	for _, size := range dim {
+		if elements > len(chars)/size {
+			return nil, fmt.Errorf("Dimensions %v do not match %d characters", dim, len(chars))
+		}
+		elements *= size
+	}
+	if elements != len(chars) {
+		return nil, fmt.Errorf("Dimensions %v do not match %d characters", dim, len(chars))
+	}
+	rows := dim[0]
+	columns := len(chars) / rows
+	for i := 0; i < rows; i++ {
+		row := make([]rune, columns)
+		for j := range row {
+			row[j] = chars[i+j*rows]
+		}
+		strs = append(strs, string(row))
+	}
+	return strs, nil
+}
+
+func extractChars(r io.Reader, order binary.ByteOrder) ([]rune, int, error) {
+	var chars []rune
+	dataType, numberOfBytes, offset, err := extractTag(r, order)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "\nextractTag() in extractChars() failed")
+	}
+	if numberOfBytes == 0 {
+		return chars, offset, nil
+	}
+
+	data, err := readMatfBytes(r, order, int(numberOfBytes))
+	if err != nil {
+		return nil, offset, fmt.Errorf("Unable to read %d bytes: %v", numberOfBytes, err)
+	}
+
+	switch int(dataType) {
+	case MiUtf8:
+		chars = []rune(string(data))
+	case MiInt8, MiUint8:
+		for _, v := range data {
+			chars = append(chars, rune(v))
+		}
+	case MiInt16, MiUint16, MiUtf16:
+		// Each UTF-16 code unit is one element of the char array
+		for i := 0; i+2 <= len(data); i += 2 {
+			chars = append(chars, rune(order.Uint16(data[i:i+2])))
+		}
+	case MiInt32, MiUint32, MiUtf32:
+		for i := 0; i+4 <= len(data); i += 4 {
+			chars = append(chars, rune(order.Uint32(data[i:i+4])))
+		}
+	default:
+		return nil, offset, fmt.Errorf("Data Type %d is not supported for characters", dataType)
+	}
+
+	return chars, offset + int(numberOfBytes), nil
+}
+
 func extractTag(r io.Reader, order binary.ByteOrder) (uint32, uint32, int, error) {
 	var dataType, numberOfBytes uint32
 	var offset int
@@ -183,10 +375,23 @@ func extractTag(r io.Reader, order binary.ByteOrder) (uint32, uint32, int, error
 	return dataType, numberOfBytes, offset, nil
 }
 
+// readMatfBytes reads numberOfBytes from r. If r is limited to the remaining
+// bytes of the enclosing data element, larger lengths are rejected before
+// anything is allocated.
 func readMatfBytes(r io.Reader, order binary.ByteOrder, numberOfBytes int) ([]byte, error) {
 	if numberOfBytes == 0 {
 		return nil, fmt.Errorf("readMatfBytes(): will not read 0 bytes")
 	}
+	remaining := int64(-1)
+	switch limited := r.(type) {
+	case *io.LimitedReader:
+		remaining = limited.N
+	case *bytes.Reader:
+		remaining = int64(limited.Len())
+	}
+	if numberOfBytes < 0 || (remaining >= 0 && int64(numberOfBytes) > remaining) {
+		return nil, fmt.Errorf("Data element of %d bytes exceeds the remaining %d bytes: %v", numberOfBytes, remaining, io.ErrUnexpectedEOF)
+	}
 	data := make([]byte, numberOfBytes)
 	err := binary.Read(r, order, &data)
 	if err != nil {
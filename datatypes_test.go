@@ -211,11 +211,11 @@ func TestExtractDataElement(t *testing.T) {
 		{name: "MiInt64", data: []byte{0x11, 0x22, 0x33, 0x44, 0x11, 0x22, 0x33, 0x44}, order: binary.LittleEndian, dataType: MiInt64, numberOfBytes: 8, step: 8, ele: 4914309075945333265},
 		{name: "MiUint64", data: []byte{0x11, 0x22, 0x33, 0x44, 0x11, 0x22, 0x33, 0x44}, order: binary.LittleEndian, dataType: MiUint64, numberOfBytes: 8, step: 8, ele: 4914309075945333265},
 		{name: "MiDouble", data: []byte{0x11, 0x22, 0x33, 0x44, 0x11, 0x22, 0x33, 0x44}, order: binary.LittleEndian, dataType: MiDouble, numberOfBytes: 8, step: 8, ele: 3.529429556587807e+20},
-		{name: "MiMatrix", data: verySimpleMatrix, order: binary.LittleEndian, dataType: MiMatrix, numberOfBytes: 1, step: 144, ele: []interface{}{MatMatrix{Name: "MaTrIx", Flags: 0x6, Class: 0x6, Dim: Dim{X: 3, Y: 3, Z: 0}, Content: NumPrt{RealPart: []interface{}{1, 0, 1, 0, 1, 0, 1, 0, 1}, ImaginaryPart: interface{}(nil)}}}},
-		{name: "MiStruct", data: verySimpleStruct, order: binary.LittleEndian, dataType: MiMatrix, numberOfBytes: 1, step: 344, ele: []interface{}{MatMatrix{Name: "testing_struct", Flags: 0x2, Class: 0x2, Dim: Dim{X: 1, Y: 1, Z: 0}, Content: StructPrt{FieldNames: []string{"field1\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00", "field2\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"}, FieldValues: map[string][]interface{}{"field1\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00": {MatMatrix{Name: "", Flags: 0x6, Class: 0x6, Dim: Dim{X: 1, Y: 1, Z: 0}, Content: NumPrt{RealPart: []interface{}{1}, ImaginaryPart: interface{}(nil)}}}, "field2\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00": {MatMatrix{Name: "", Flags: 0x6, Class: 0x6, Dim: Dim{X: 1, Y: 1, Z: 0}, Content: NumPrt{RealPart: []interface{}{2}, ImaginaryPart: interface{}(nil)}}}}}}}},
-		{name: "Mi3dMatrix", data: verySimple3DMatrix, order: binary.LittleEndian, dataType: MiMatrix, numberOfBytes: 1, step: 1048, ele: []interface{}{MatMatrix{Name: "matrix3d", Flags: 0x806, Class: 0x6, Dim: Dim{X: 3, Y: 4, Z: 5}, Content: NumPrt{RealPart: []interface{}{42, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, ImaginaryPart: []interface{}{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}}}}},
-		{name: "MiCell", data: verySimpleCell, order: binary.LittleEndian, dataType: MiMatrix, numberOfBytes: 1, step: 128, ele: []interface{}{MatMatrix{Name: "cell", Flags: 0x1, Class: 0x1, Dim: Dim{X: 1, Y: 1, Z: 3}, Content: CellPrt{Cells: []MatMatrix{{Name: "", Flags: 0x6, Class: 0x6, Dim: Dim{X: 0, Y: 0, Z: 0}, Content: NumPrt{RealPart: []interface{}(nil), ImaginaryPart: interface{}(nil)}}, {Name: "", Flags: 0x6, Class: 0x6, Dim: Dim{X: 0, Y: 0, Z: 0}, Content: NumPrt{RealPart: []interface{}(nil), ImaginaryPart: interface{}(nil)}}, {Name: "", Flags: 0x6, Class: 0x6, Dim: Dim{X: 0, Y: 0, Z: 0}, Content: NumPrt{RealPart: []interface{}(nil), ImaginaryPart: interface{}(nil)}}}}}}},
-		{name: "MxCharClass", data: verySimpleChar, order: binary.LittleEndian, dataType: MiMatrix, numberOfBytes: 1, step: 160, ele: []interface{}{MatMatrix{Name: "coll2", Flags: 0x4, Class: 0x4, Dim: Dim{X: 3, Y: 13, Z: 0}, Content: CharPrt{Chars: []string{"string1      ", "STRING2      ", "# a b c d e f"}}}}},
+		{name: "MiMatrix", data: verySimpleMatrix, order: binary.LittleEndian, dataType: MiMatrix, numberOfBytes: 1, step: 144, ele: []interface{}{MatMatrix{Name: "MaTrIx", Flags: 0x6, Class: 0x6, Dim: Dim{3, 3}, Content: NumPrt{RealPart: []interface{}{1, 0, 1, 0, 1, 0, 1, 0, 1}, ImaginaryPart: interface{}(nil)}}}},
+		{name: "MiStruct", data: verySimpleStruct, order: binary.LittleEndian, dataType: MiMatrix, numberOfBytes: 1, step: 344, ele: []interface{}{MatMatrix{Name: "testing_struct", Flags: 0x2, Class: 0x2, Dim: Dim{1, 1}, Content: StructPrt{FieldNames: []string{"field1\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00", "field2\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"}, FieldValues: map[string][]interface{}{"field1\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00": {MatMatrix{Name: "", Flags: 0x6, Class: 0x6, Dim: Dim{1, 1}, Content: NumPrt{RealPart: []interface{}{1}, ImaginaryPart: interface{}(nil)}}}, "field2\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00": {MatMatrix{Name: "", Flags: 0x6, Class: 0x6, Dim: Dim{1, 1}, Content: NumPrt{RealPart: []interface{}{2}, ImaginaryPart: interface{}(nil)}}}}}}}},
+		{name: "Mi3dMatrix", data: verySimple3DMatrix, order: binary.LittleEndian, dataType: MiMatrix, numberOfBytes: 1, step: 1048, ele: []interface{}{MatMatrix{Name: "matrix3d", Flags: 0x806, Class: 0x6, Dim: Dim{3, 4, 5}, Content: NumPrt{RealPart: []interface{}{42, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, ImaginaryPart: []interface{}{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}}}}},
+		{name: "MiCell", data: verySimpleCell, order: binary.LittleEndian, dataType: MiMatrix, numberOfBytes: 1, step: 256, ele: []interface{}{MatMatrix{Name: "cell", Flags: 0x1, Class: 0x1, Dim: Dim{1, 1, 3}, Content: CellPrt{Cells: []MatMatrix{{Name: "", Flags: 0x6, Class: 0x6, Dim: Dim{0, 0}, Content: NumPrt{RealPart: []interface{}(nil), ImaginaryPart: interface{}(nil)}}, {Name: "", Flags: 0x6, Class: 0x6, Dim: Dim{0, 0}, Content: NumPrt{RealPart: []interface{}(nil), ImaginaryPart: interface{}(nil)}}, {Name: "", Flags: 0x6, Class: 0x6, Dim: Dim{0, 0}, Content: NumPrt{RealPart: []interface{}(nil), ImaginaryPart: interface{}(nil)}}}}}}},
+		{name: "MxCharClass", data: verySimpleChar, order: binary.LittleEndian, dataType: MiMatrix, numberOfBytes: 1, step: 152, ele: []interface{}{MatMatrix{Name: "coll2", Flags: 0x4, Class: 0x4, Dim: Dim{3, 13}, Content: CharPrt{Chars: []string{"string1      ", "STRING2      ", "# a b c d e f"}}}}},
 	}
 
 	for _, tc := range tests {
@@ -240,6 +240,80 @@ func TestExtractDataElement(t *testing.T) {
 	}
 }
 
+func TestDecodeValues(t *testing.T) {
+	t.Parallel()
+
+	data := []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99}
+	tests := []struct {
+		name     string
+		order    binary.ByteOrder
+		dataType int
+		values   interface{}
+		err      bool
+	}{
+		{name: "MiInt8", order: binary.LittleEndian, dataType: MiInt8, values: []int8{0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, -0x78, -0x67}},
+		{name: "MiUint8", order: binary.LittleEndian, dataType: MiUint8, values: []uint8{0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99}},
+		{name: "MiInt16", order: binary.BigEndian, dataType: MiInt16, values: []int16{0x1122, 0x3344, 0x5566, 0x7788}},
+		{name: "MiUint16", order: binary.LittleEndian, dataType: MiUint16, values: []uint16{0x2211, 0x4433, 0x6655, 0x8877}},
+		{name: "MiInt32", order: binary.LittleEndian, dataType: MiInt32, values: []int32{0x44332211, -0x778899ab}},
+		{name: "MiUint32", order: binary.BigEndian, dataType: MiUint32, values: []uint32{0x11223344, 0x55667788}},
+		{name: "MiSingle", order: binary.BigEndian, dataType: MiSingle, values: []float32{1.2795344e-28, 1.5837566e+13}},
+		{name: "MiInt64", order: binary.LittleEndian, dataType: MiInt64, values: []int64{-0x778899aabbccddef}},
+		{name: "MiUint64", order: binary.LittleEndian, dataType: MiUint64, values: []uint64{0x8877665544332211}},
+		{name: "MiDouble", order: binary.BigEndian, dataType: MiDouble, values: []float64{3.841412024471731e-226}},
+		{name: "Unknown", order: binary.LittleEndian, dataType: MiMatrix, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := decodeValues(tc.order, tc.dataType, data)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(values, tc.values) {
+				t.Fatalf("Expected: %#v\tGot: %#v", tc.values, values)
+			}
+		})
+	}
+}
+
+func TestPromoteValues(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		values   interface{}
+		dataType int
+		promoted interface{}
+		err      bool
+	}{
+		{name: "Double", values: []uint8{0, 255}, dataType: MiDouble, promoted: []float64{0, 255}},
+		{name: "Single", values: []int16{-3}, dataType: MiSingle, promoted: []float32{-3}},
+		{name: "Int32", values: []int8{-128, 127}, dataType: MiInt32, promoted: []int32{-128, 127}},
+		{name: "Uint64", values: []uint32{1<<32 - 1}, dataType: MiUint64, promoted: []uint64{1<<32 - 1}},
+		{name: "Unchanged", values: []int16{1}, dataType: MiInt16, promoted: []int16{1}},
+		{name: "Nil", dataType: MiDouble},
+		{name: "Negative", values: []int32{-1}, dataType: MiUint8, err: true},
+		{name: "Overflow", values: []int32{128}, dataType: MiInt8, err: true},
+		{name: "OverflowUnsigned", values: []uint32{1 << 16}, dataType: MiUint16, err: true},
+		{name: "Fraction", values: []float64{1.5}, dataType: MiInt32, err: true},
+		{name: "InexactSingle", values: []int32{1<<24 + 1}, dataType: MiSingle, err: true},
+		{name: "InexactDouble", values: []int64{1<<53 + 1}, dataType: MiDouble, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			promoted, err := promoteValues(tc.values, tc.dataType)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(promoted, tc.promoted) {
+				t.Fatalf("Expected: %#v\tGot: %#v", tc.promoted, promoted)
+			}
+		})
+	}
+}
+
 func TestExtractNumeric(t *testing.T) {
 	t.Parallel()
 
@@ -356,3 +430,36 @@ func TestExtractArrayName(t *testing.T) {
 		})
 	}
 }
+
+func TestCharRows(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		chars []rune
+		dim   Dim
+		strs  []string
+		err   bool
+	}{
+		{name: "Rows", chars: []rune("adbecf"), dim: Dim{2, 3}, strs: []string{"abc", "def"}},
+		{name: "Pages", chars: []rune("abcd"), dim: Dim{1, 2, 2}, strs: []string{"abcd"}},
+		{name: "Empty", dim: Dim{3, 0}},
+		{name: "NoDims"},
+		{name: "TooManyRows", chars: []rune("ab"), dim: Dim{1 << 30, 1}, err: true},
+		{name: "TooFewChars", chars: []rune("abc"), dim: Dim{2, 2}, err: true},
+		{name: "Overflow", chars: []rune("ab"), dim: Dim{1 << 62, 1 << 62, 2}, err: true},
+		{name: "Negative", chars: []rune("ab"), dim: Dim{-1, -2}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			strs, err := charRows(tc.chars, tc.dim)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(strs, tc.strs) {
+				t.Fatalf("Expected: %#v\tGot: %#v", tc.strs, strs)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package matf
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Datetime represents a MATLAB datetime array
+type Datetime struct {
+	Times    []time.Time // Not-a-Time values are zero.
+	TimeZone string      // Empty for datetimes without time zone.
+	Format   string
+}
+
+// Duration represents a MATLAB duration array
+type Duration struct {
+	Durations []time.Duration
+	Format    string
+}
+
+// CalendarDuration represents a MATLAB calendarDuration array
+type CalendarDuration struct {
+	Months    []int
+	Days      []int
+	Durations []time.Duration // Time component of each calendar duration.
+	Format    string
+}
+
+// readString returns the content of a char array as single string
+func readString(mat MatMatrix) (string, error) {
+	switch content := mat.Content.(type) {
+	case CharPrt:
+		return strings.Join(content.Chars, ""), nil
+	case NumPrt:
+		// Empty arrays are stored as double
+		if mat.NumElements() == 0 {
+			return "", nil
+		}
+	}
+	return "", fmt.Errorf("Expected char array, got %T", mat.Content)
+}
+
+// optionalString returns the content of a char array property or an empty
+// string, if the object does not have this property.
+func optionalString(s *Subsystem, object McosObject, name string, depth int) (string, error) {
+	if _, ok := object.Properties[name]; !ok {
+		return "", nil
+	}
+	value, err := s.property(object, name, depth)
+	if err != nil {
+		return "", err
+	}
+	return readString(value)
+}
+
+// millisToDuration converts milliseconds into a time.Duration
+func millisToDuration(millis float64) time.Duration {
+	return time.Duration(math.Round(millis * float64(time.Millisecond)))
+}
+
+// decodeDatetime decodes datetime objects. The real part of their data
+// contains the milliseconds since 1970-01-01 and the imaginary part the
+// fraction of milliseconds. Datetimes without time zone store their local
+// time as UTC.
+func decodeDatetime(s *Subsystem, dims Dim, objects []McosObject, depth int) (Dim, interface{}, error) {
+	var content Datetime
+	var err error
+
+	if len(objects) != 1 {
+		return nil, nil, fmt.Errorf("Expected a single datetime object, got %d", len(objects))
+	}
+	object := objects[0]
+
+	data, err := s.property(object, "data", depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, ok := data.Content.(NumPrt)
+	if !ok {
+		return nil, nil, fmt.Errorf("Expected numeric data, got %T", data.Content)
+	}
+	millis, err := float64s(values.RealPart)
+	if err != nil {
+		return nil, nil, err
+	}
+	fractions, err := float64s(values.ImaginaryPart)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(fractions) != 0 && len(fractions) != len(millis) {
+		return nil, nil, fmt.Errorf("Datetime contains %d fractions for %d values", len(fractions), len(millis))
+	}
+
+	if content.TimeZone, err = optionalString(s, object, "tz", depth); err != nil {
+		return nil, nil, err
+	}
+	if content.Format, err = optionalString(s, object, "fmt", depth); err != nil {
+		return nil, nil, err
+	}
+	location := time.UTC
+	if len(content.TimeZone) != 0 {
+		// Fall back to UTC, if the time zone database is not available
+		if l, err := time.LoadLocation(content.TimeZone); err == nil {
+			location = l
+		}
+	}
+
+	for i, ms := range millis {
+		if math.IsNaN(ms) || math.IsInf(ms, 0) {
+			content.Times = append(content.Times, time.Time{})
+			continue
+		}
+		seconds := math.Floor(ms / 1000)
+		nanoseconds := (ms - seconds*1000) * float64(time.Millisecond)
+		if len(fractions) != 0 {
+			nanoseconds += fractions[i] * float64(time.Millisecond)
+		}
+		content.Times = append(content.Times, time.Unix(int64(seconds), int64(math.Round(nanoseconds))).In(location))
+	}
+	return data.Dim, content, nil
+}
+
+// decodeDuration decodes duration objects, that store milliseconds.
+func decodeDuration(s *Subsystem, dims Dim, objects []McosObject, depth int) (Dim, interface{}, error) {
+	var content Duration
+	var err error
+
+	if len(objects) != 1 {
+		return nil, nil, fmt.Errorf("Expected a single duration object, got %d", len(objects))
+	}
+	object := objects[0]
+
+	data, err := s.property(object, "millis", depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, ok := data.Content.(NumPrt)
+	if !ok {
+		return nil, nil, fmt.Errorf("Expected numeric data, got %T", data.Content)
+	}
+	millis, err := float64s(values.RealPart)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, ms := range millis {
+		content.Durations = append(content.Durations, millisToDuration(ms))
+	}
+	if content.Format, err = optionalString(s, object, "fmt", depth); err != nil {
+		return nil, nil, err
+	}
+	return data.Dim, content, nil
+}
+
+// decodeCalendarDuration decodes calendarDuration objects. Their components
+// months, days and millis are either arrays of the same size or scalars,
+// that apply to all elements.
+func decodeCalendarDuration(s *Subsystem, dims Dim, objects []McosObject, depth int) (Dim, interface{}, error) {
+	var content CalendarDuration
+	var err error
+
+	if len(objects) != 1 {
+		return nil, nil, fmt.Errorf("Expected a single calendarDuration object, got %d", len(objects))
+	}
+	object := objects[0]
+
+	data, err := s.property(object, "components", depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	components, ok := data.Content.(StructPrt)
+	if !ok {
+		return nil, nil, fmt.Errorf("Expected struct of components, got %T", data.Content)
+	}
+
+	dims = Dim{1, 1}
+	values := make(map[string][]float64)
+	for _, name := range []string{"months", "days", "millis"} {
+		fieldValues, ok := lookupField(components, name)
+		if !ok || len(fieldValues) != 1 {
+			return nil, nil, fmt.Errorf("Component %s is missing", name)
+		}
+		component, ok := fieldValues[0].(MatMatrix)
+		if !ok {
+			return nil, nil, fmt.Errorf("Unexpected component %s: %T", name, fieldValues[0])
+		}
+		numeric, ok := component.Content.(NumPrt)
+		if !ok {
+			return nil, nil, fmt.Errorf("Expected numeric component %s, got %T", name, component.Content)
+		}
+		if values[name], err = float64s(numeric.RealPart); err != nil {
+			return nil, nil, err
+		}
+		if len(values[name]) > 1 {
+			if dims.NumElements() > 1 && dims.NumElements() != len(values[name]) {
+				return nil, nil, fmt.Errorf("Components of calendarDuration differ in size")
+			}
+			dims = component.Dim
+		}
+	}
+
+	component := func(name string, i int) float64 {
+		switch len(values[name]) {
+		case 0:
+			return 0
+		case 1:
+			return values[name][0]
+		}
+		return values[name][i]
+	}
+	for i := 0; i < dims.NumElements(); i++ {
+		content.Months = append(content.Months, int(component("months", i)))
+		content.Days = append(content.Days, int(component("days", i)))
+		content.Durations = append(content.Durations, millisToDuration(component("millis", i)))
+	}
+	if content.Format, err = optionalString(s, object, "fmt", depth); err != nil {
+		return nil, nil, err
+	}
+	return dims, content, nil
+}
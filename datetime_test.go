@@ -0,0 +1,96 @@
+package matf
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func chars(str string) MatMatrix {
+	return MatMatrix{Class: uint32(MxCharClass), Dim: Dim{1, len(str)}, Content: CharPrt{Chars: []string{str}}}
+}
+
+func TestDecodeDatetime(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		properties map[string]MatMatrix
+		dims       Dim
+		times      []time.Time
+		err        bool
+	}{
+		{name: "Unzoned", properties: map[string]MatMatrix{
+			"data": {Class: uint32(MxDoubleClass), Dim: Dim{1, 2}, Content: NumPrt{RealPart: []interface{}{1500000000123.0, -1500.0}, ImaginaryPart: []interface{}{0.5, 0.0}}},
+			"tz":   doubles(),
+			"fmt":  chars("yyyy-MM-dd"),
+		}, dims: Dim{1, 2}, times: []time.Time{time.Unix(1500000000, 123500000).UTC(), time.Unix(-2, 500000000).UTC()}},
+		{name: "NaT", properties: map[string]MatMatrix{
+			"data": {Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []interface{}{math.NaN()}}},
+		}, dims: Dim{1, 1}, times: []time.Time{{}}},
+		{name: "NoData", properties: map[string]MatMatrix{"tz": chars("UTC")}, err: true},
+		{name: "Fractions", properties: map[string]MatMatrix{
+			"data": {Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []interface{}{1.0}, ImaginaryPart: []interface{}{1.0, 2.0}}},
+		}, err: true},
+		{name: "TimeZone", properties: map[string]MatMatrix{"data": doubles(1), "tz": doubles(1)}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dims, content, err := decodeDatetime(&Subsystem{}, nil, []McosObject{{Class: McosClass{Name: "datetime"}, Properties: tc.properties}}, 0)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if tc.err {
+				return
+			}
+			if !reflect.DeepEqual(dims, tc.dims) {
+				t.Fatalf("Expected dims %v, got: %v", tc.dims, dims)
+			}
+			times := content.(Datetime).Times
+			if len(times) != len(tc.times) {
+				t.Fatalf("Expected %v, got: %v", tc.times, times)
+			}
+			for i := range times {
+				if !times[i].Equal(tc.times[i]) {
+					t.Fatalf("Expected %v, got: %v", tc.times[i], times[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeDuration(t *testing.T) {
+	fixture := mcosFixture{
+		names:   []string{"millis", "fmt", "duration", "components", "calendarDuration", "months", "days"},
+		classes: [][2]uint32{{0, 3}, {0, 5}},
+		objects: [][]uint32{
+			{1, 1, 1, 0, 2, 1, 1},
+			{2, 4, 1, 2},
+		},
+		cells: []MatMatrix{
+			{Class: uint32(MxDoubleClass), Dim: Dim{2, 1}, Content: NumPrt{RealPart: []interface{}{1500.0, -60000.0}}},
+			chars("hh:mm:ss"),
+			{Class: uint32(MxStructClass), Dim: Dim{1, 1}, Content: StructPrt{FieldNames: []string{"months", "days", "millis"}, FieldValues: map[string][]interface{}{
+				"months": {MatMatrix{Class: uint32(MxDoubleClass), Dim: Dim{1, 2}, Content: NumPrt{RealPart: []interface{}{1.0, 14.0}}}},
+				"days":   {doubles(0)},
+				"millis": {doubles(3600000)},
+			}}},
+		},
+	}
+	elements := readMcosFile(t, []MatMatrix{
+		{Name: "d", Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "duration", Metadata: mcosRef(1, []uint32{1, 1}, 1)}},
+		{Name: "c", Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "calendarDuration", Metadata: mcosRef(2, []uint32{1, 1}, 2)}},
+	}, fixture)
+
+	expected := Duration{Durations: []time.Duration{1500 * time.Millisecond, -time.Minute}, Format: "hh:mm:ss"}
+	if !reflect.DeepEqual(elements[0].Content, expected) || !reflect.DeepEqual(elements[0].Dim, Dim{2, 1}) {
+		t.Fatalf("Expected %#v, got: %v %#v", expected, elements[0].Dim, elements[0].Content)
+	}
+
+	calendar := CalendarDuration{Months: []int{1, 14}, Days: []int{0, 0}, Durations: []time.Duration{time.Hour, time.Hour}}
+	if !reflect.DeepEqual(elements[1].Content, calendar) || !reflect.DeepEqual(elements[1].Dim, Dim{1, 2}) {
+		t.Fatalf("Expected %#v, got: %v %#v", calendar, elements[1].Dim, elements[1].Content)
+	}
+}
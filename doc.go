@@ -11,7 +11,6 @@ For example, you can use the data in gonum:
 		"io"
 		"log"
 		"os"
-		"reflect"
 
 		"github.com/florianl/matf"
 		"gonum.org/v1/gonum/mat"
@@ -28,14 +27,17 @@ For example, you can use the data in gonum:
 			log.Fatal(err)
 			return
 		}
-		r, c, _, err := element.Dimensions()
-		data := []float64{}
-		slice := reflect.ValueOf(element.Content.(matf.NumPrt).RealPart)
-		for i := 0; i < slice.Len(); i++ {
-			value := reflect.ValueOf(slice.Index(i).Interface()).Float()
-			data = append(data, value)
+		dims, err := element.Dimensions()
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		data, err := element.Float64s()
+		if err != nil {
+			log.Fatal(err)
+			return
 		}
-		dense := mat.NewDense(r, c, data)
+		dense := mat.NewDense(dims[0], dims[1], data)
 		fmt.Printf("dense = %v\n", mat.Formatted(dense, mat.Prefix("        ")))
 	}
 
@@ -46,7 +48,6 @@ Or use it in gorgonia:
 		"io"
 		"log"
 		"os"
-		"reflect"
 
 		"github.com/florianl/matf"
 		"gorgonia.org/gorgonia"
@@ -64,16 +65,19 @@ Or use it in gorgonia:
 			log.Fatal(err)
 			return
 		}
-		r, c, _, err := element.Dimensions()
-		data := []float64{}
-		slice := reflect.ValueOf(element.Content.(matf.NumPrt).RealPart)
-		for i := 0; i < slice.Len(); i++ {
-			value := reflect.ValueOf(slice.Index(i).Interface()).Float()
-			data = append(data, value)
+		dims, err := element.Dimensions()
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		data, err := element.Float64s()
+		if err != nil {
+			log.Fatal(err)
+			return
 		}
-		t := tensor.New(tensor.WithShape(r,c), tensor.WithBacking(data))
+		t := tensor.New(tensor.WithShape(dims...), tensor.WithBacking(data))
 		g := gorgonia.NewGraph()
-		w := gorgonia.NewMatrix(g, gorgonia.Float64, gorgonia.WithShape(r,c), gorgonia.WithValue(t))
+		w := gorgonia.NewMatrix(g, gorgonia.Float64, gorgonia.WithShape(dims...), gorgonia.WithValue(t))
 		gorgonia.Must(gorgonia.Sigmoid(w))
 		m := gorgonia.NewTapeMachine(g)
 		if err := m.RunAll(); err != nil {
@@ -0,0 +1,48 @@
+//go:build go1.16
+// +build go1.16
+
+package matf
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/pkg/errors"
+)
+
+// OpenFS opens the MAT-file name from fsys, like Open does. Files, that do
+// not implement io.ReaderAt, are read into memory.
+func OpenFS(fsys fs.FS, name string) (*Matf, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a file", name)
+	}
+
+	r, ok := f.(io.ReaderAt)
+	if !ok {
+		defer f.Close()
+		mat, err := NewReader(f)
+		if err != nil {
+			return nil, errors.Wrap(err, "\nNewReader() in OpenFS() failed")
+		}
+		return mat, nil
+	}
+
+	mat, err := NewReaderAt(r, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "\nNewReaderAt() in OpenFS() failed")
+	}
+	mat.closer = f
+	return mat, nil
+}
@@ -0,0 +1,64 @@
+//go:build go1.16
+// +build go1.16
+
+package matf
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// streamFS hides the io.ReaderAt of the files of a fs.FS
+type streamFS struct {
+	fs.FS
+}
+
+type streamFile struct {
+	fs.File
+}
+
+func (s streamFS) Open(name string) (fs.File, error) {
+	f, err := s.FS.Open(name)
+	return streamFile{f}, err
+}
+
+func TestOpenFS(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"model.mat":   {Data: compressedMatf},
+		"corrupt.mat": {Data: noMatf},
+		"dir/x.mat":   {Data: compressedMatf},
+	}
+
+	tests := []struct {
+		name string
+		fsys fs.FS
+		file string
+		err  bool
+	}{
+		{name: "MapFS", fsys: fsys, file: "model.mat"},
+		{name: "Stream", fsys: streamFS{fsys}, file: "model.mat"},
+		{name: "Corrupt", fsys: fsys, file: "corrupt.mat", err: true},
+		{name: "Directory", fsys: fsys, file: "dir", err: true},
+		{name: "Missing", fsys: fsys, file: "missing.mat", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			x, err := OpenFS(tc.fsys, tc.file)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if tc.err {
+				return
+			}
+			defer Close(x)
+			if _, err := ReadDataElement(x); err != nil && err != io.EOF {
+				t.Fatalf("Could not read data element: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,1073 @@
+package matf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// hdf5Signature identifies the superblock of a HDF5 file
+var hdf5Signature = []byte{0x89, 'H', 'D', 'F', '\r', '\n', 0x1a, '\n'}
+
+// hdf5Undefined is the address of data, which is not allocated
+const hdf5Undefined = ^uint64(0)
+
+// maxBTreeDepth limits the levels of B-trees, that are traversed.
+const maxBTreeDepth = 64
+
+// maxDeflateRatio is the largest ratio, by which deflate can compress data.
+const maxDeflateRatio = 1032
+
+// Types of messages in a HDF5 object header
+const (
+	hdf5DataspaceMessage      = 0x0001
+	hdf5DatatypeMessage       = 0x0003
+	hdf5LayoutMessage         = 0x0008
+	hdf5FilterPipelineMessage = 0x000B
+	hdf5AttributeMessage      = 0x000C
+	hdf5ContinuationMessage   = 0x0010
+	hdf5SymbolTableMessage    = 0x0011
+)
+
+// Classes of HDF5 datatypes
+const (
+	hdf5FixedPoint    = 0
+	hdf5FloatingPoint = 1
+	hdf5String        = 3
+	hdf5Compound      = 6
+	hdf5Reference     = 7
+	hdf5VariableLen   = 9
+)
+
+// Classes of the HDF5 data layout
+const (
+	hdf5Compact    = 0
+	hdf5Contiguous = 1
+	hdf5Chunked    = 2
+)
+
+// Filters of the HDF5 filter pipeline
+const (
+	hdf5Deflate    = 1
+	hdf5Shuffle    = 2
+	hdf5Fletcher32 = 3
+)
+
+// hdf5File provides access to the objects of a HDF5 file
+type hdf5File struct {
+	r       io.ReaderAt
+	size    int64  // Size of the whole file.
+	base    int64  // Position of the superblock, all addresses are relative to it.
+	offsets int    // Number of bytes of an address.
+	lengths int    // Number of bytes of a length.
+	root    uint64 // Address of the object header of the root group.
+}
+
+// hdf5Buffer decodes the little-endian fields of HDF5 structures. After the
+// first failure, it keeps returning zero values and reports the error in err.
+type hdf5Buffer struct {
+	f    *hdf5File
+	data []byte
+	pos  int
+	err  error
+}
+
+func (b *hdf5Buffer) bytes(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if n < 0 || b.pos+n > len(b.data) {
+		b.err = fmt.Errorf("Unexpected end of HDF5 structure at %d", b.pos)
+		return nil
+	}
+	data := b.data[b.pos : b.pos+n]
+	b.pos += n
+	return data
+}
+
+func (b *hdf5Buffer) skip(n int) {
+	b.bytes(n)
+}
+
+// align skips the padding up to the next multiple of n relative to start
+func (b *hdf5Buffer) align(start, n int) {
+	if rest := (b.pos - start) % n; rest != 0 {
+		b.skip(n - rest)
+	}
+}
+
+func (b *hdf5Buffer) uint(size int) uint64 {
+	data := b.bytes(size)
+	if data == nil {
+		return 0
+	}
+	var value uint64
+	for i := size - 1; i >= 0; i-- {
+		value = value<<8 | uint64(data[i])
+	}
+	return value
+}
+
+func (b *hdf5Buffer) uint8() int  { return int(b.uint(1)) }
+func (b *hdf5Buffer) uint16() int { return int(b.uint(2)) }
+func (b *hdf5Buffer) uint32() int { return int(b.uint(4)) }
+
+// address returns an address, all bits set indicate an undefined address
+func (b *hdf5Buffer) address() uint64 {
+	value := b.uint(b.f.offsets)
+	if b.f.offsets < 8 && value == 1<<(8*uint(b.f.offsets))-1 {
+		return hdf5Undefined
+	}
+	return value
+}
+
+func (b *hdf5Buffer) length() uint64 {
+	return b.uint(b.f.lengths)
+}
+
+// cstring returns a NUL terminated string
+func (b *hdf5Buffer) cstring() string {
+	if b.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(b.data[b.pos:], 0)
+	if end < 0 {
+		b.err = fmt.Errorf("Unterminated string in HDF5 structure at %d", b.pos)
+		return ""
+	}
+	str := string(b.data[b.pos : b.pos+end])
+	b.pos += end + 1
+	return str
+}
+
+// findSuperblock searches the superblock, which is located at 0, 512, 1024,
+// 2048 and so on.
+func findSuperblock(r io.ReaderAt, size int64) (int64, error) {
+	signature := make([]byte, len(hdf5Signature))
+	for offset := int64(0); offset+int64(len(signature)) <= size; offset = max64(512, offset*2) {
+		if _, err := r.ReadAt(signature, offset); err != nil {
+			return 0, errors.Wrap(err, "\nReadAt() in findSuperblock() failed")
+		}
+		if bytes.Equal(signature, hdf5Signature) {
+			return offset, nil
+		}
+	}
+	return 0, fmt.Errorf("No HDF5 superblock found")
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// openHDF5 parses the superblock of a HDF5 file
+func openHDF5(r io.ReaderAt, size int64) (*hdf5File, error) {
+	base, err := findSuperblock(r, size)
+	if err != nil {
+		return nil, err
+	}
+	f := &hdf5File{r: r, size: size, base: base}
+
+	data := make([]byte, 24)
+	if _, err := r.ReadAt(data, base); err != nil {
+		return nil, errors.Wrap(err, "\nReadAt() in openHDF5() failed")
+	}
+	version := int(data[8])
+	if version > 1 {
+		return nil, fmt.Errorf("Version %d of the HDF5 superblock is not supported", version)
+	}
+	f.offsets = int(data[13])
+	f.lengths = int(data[14])
+	if (f.offsets != 4 && f.offsets != 8) || (f.lengths != 4 && f.lengths != 8) {
+		return nil, fmt.Errorf("Unsupported size of HDF5 addresses %d or lengths %d", f.offsets, f.lengths)
+	}
+
+	// The superblock of version 1 contains an additional B-tree K value
+	fixed := 24
+	if version == 1 {
+		fixed += 4
+	}
+	data, err = f.readAt(0, fixed+4*f.offsets+f.symbolEntrySize())
+	if err != nil {
+		return nil, err
+	}
+	b := &hdf5Buffer{f: f, data: data, pos: fixed}
+	// Base address, free-space info, end of file and driver information
+	b.skip(4 * f.offsets)
+	_, f.root = b.symbolEntry()
+	return f, b.err
+}
+
+// readAt reads n bytes at an address, relative to the superblock
+func (f *hdf5File) readAt(address uint64, n int) ([]byte, error) {
+	if address == hdf5Undefined || int64(address) < 0 || f.base+int64(address)+int64(n) > f.size || n < 0 {
+		return nil, fmt.Errorf("Invalid HDF5 address %#x", address)
+	}
+	data := make([]byte, n)
+	if _, err := f.r.ReadAt(data, f.base+int64(address)); err != nil {
+		return nil, errors.Wrap(err, "\nReadAt() in readAt() failed")
+	}
+	return data, nil
+}
+
+// readSignature reads n bytes of a structure, that starts with signature
+func (f *hdf5File) readSignature(address uint64, signature string, n int) (*hdf5Buffer, error) {
+	data, err := f.readAt(address, n)
+	if err != nil {
+		return nil, err
+	}
+	if string(data[:len(signature)]) != signature {
+		return nil, fmt.Errorf("Expected signature %s at HDF5 address %#x", signature, address)
+	}
+	return &hdf5Buffer{f: f, data: data, pos: len(signature)}, nil
+}
+
+func (f *hdf5File) symbolEntrySize() int {
+	return 2*f.offsets + 24
+}
+
+// symbolEntry returns the link name offset and the object header address of
+// a symbol table entry.
+func (b *hdf5Buffer) symbolEntry() (uint64, uint64) {
+	name := b.uint(b.f.offsets)
+	address := b.address()
+	// Cache type, reserved and scratch-pad space
+	b.skip(24)
+	return name, address
+}
+
+// hdf5Message is a message of an object header
+type hdf5Message struct {
+	kind int
+	data []byte
+}
+
+// hdf5Object is the header of a group or dataset
+type hdf5Object struct {
+	f        *hdf5File
+	address  uint64
+	messages []hdf5Message
+}
+
+// readObject reads the messages of an object header in version 1
+func (f *hdf5File) readObject(address uint64) (*hdf5Object, error) {
+	prefix, err := f.readAt(address, 16)
+	if err != nil {
+		return nil, err
+	}
+	if prefix[0] != 1 {
+		return nil, fmt.Errorf("Version %d of the HDF5 object header is not supported", prefix[0])
+	}
+	object := &hdf5Object{f: f, address: address}
+	numberOfMessages := int(binary.LittleEndian.Uint16(prefix[2:4]))
+	blocks := []struct{ address, length uint64 }{{address + 16, uint64(binary.LittleEndian.Uint32(prefix[8:12]))}}
+
+	for i := 0; i < len(blocks) && len(object.messages) < numberOfMessages; i++ {
+		data, err := f.readAt(blocks[i].address, int(blocks[i].length))
+		if err != nil {
+			return nil, err
+		}
+		b := &hdf5Buffer{f: f, data: data}
+		for b.pos+8 <= len(b.data) && len(object.messages) < numberOfMessages {
+			kind := b.uint16()
+			size := b.uint16()
+			// Flags and reserved
+			b.skip(4)
+			message := hdf5Message{kind: kind, data: b.bytes(size)}
+			if b.err != nil {
+				return nil, b.err
+			}
+			object.messages = append(object.messages, message)
+			if kind == hdf5ContinuationMessage {
+				c := &hdf5Buffer{f: f, data: message.data}
+				block := struct{ address, length uint64 }{c.address(), c.length()}
+				if c.err != nil {
+					return nil, c.err
+				}
+				blocks = append(blocks, block)
+			}
+		}
+	}
+	return object, nil
+}
+
+// message returns the first message of a kind
+func (o *hdf5Object) message(kind int) (*hdf5Buffer, bool) {
+	for _, message := range o.messages {
+		if message.kind == kind {
+			return &hdf5Buffer{f: o.f, data: message.data}, true
+		}
+	}
+	return nil, false
+}
+
+// isGroup returns true, if the object is a group with a symbol table
+func (o *hdf5Object) isGroup() bool {
+	_, ok := o.message(hdf5SymbolTableMessage)
+	return ok
+}
+
+// hdf5Space describes the dimensions of a dataset or attribute
+type hdf5Space struct {
+	dims     []uint64 // Empty for scalars.
+	elements uint64
+}
+
+func parseDataspace(b *hdf5Buffer) hdf5Space {
+	var space hdf5Space
+	version := b.uint8()
+	rank := b.uint8()
+	flags := b.uint8()
+	null := false
+	if version == 1 {
+		b.skip(5)
+	} else {
+		null = b.uint8() == 2
+	}
+	space.elements = 1
+	for i := 0; i < rank; i++ {
+		dim := b.length()
+		space.dims = append(space.dims, dim)
+		space.elements *= dim
+	}
+	if null {
+		space.elements = 0
+	}
+	if flags&1 == 1 {
+		// Maximum dimensions
+		b.skip(rank * b.f.lengths)
+	}
+	return space
+}
+
+// hdf5Type describes the type of the elements of a dataset or attribute
+type hdf5Type struct {
+	class   int
+	size    int
+	order   binary.ByteOrder
+	signed  bool
+	members []hdf5Member // Members of a compound type.
+	base    *hdf5Type    // Base type of a variable-length type.
+}
+
+// hdf5Member is a member of a compound type
+type hdf5Member struct {
+	name     string
+	offset   int
+	datatype hdf5Type
+}
+
+func parseDatatype(b *hdf5Buffer) (hdf5Type, error) {
+	var t hdf5Type
+	classAndVersion := b.uint8()
+	bits := int(b.uint(3))
+	t.class = classAndVersion & 0x0F
+	version := classAndVersion >> 4
+	t.size = b.uint32()
+	t.order = binary.LittleEndian
+	if bits&1 == 1 {
+		t.order = binary.BigEndian
+	}
+
+	switch t.class {
+	case hdf5FixedPoint:
+		t.signed = bits&0x08 != 0
+		// Bit offset and precision
+		b.skip(4)
+	case hdf5FloatingPoint:
+		if bits&0x40 != 0 {
+			return t, fmt.Errorf("VAX floating-point numbers are not supported")
+		}
+		// Bit offset, precision, location and size of exponent and mantissa and the exponent bias
+		b.skip(12)
+	case hdf5String, hdf5Reference:
+	case hdf5Compound:
+		numberOfMembers := bits & 0xFFFF
+		for i := 0; i < numberOfMembers && b.err == nil; i++ {
+			var member hdf5Member
+			start := b.pos
+			member.name = b.cstring()
+			switch version {
+			case 1:
+				b.align(start, 8)
+				member.offset = b.uint32()
+				// Dimensionality, reserved, permutation and dimension sizes
+				b.skip(28)
+			case 2:
+				b.align(start, 8)
+				member.offset = b.uint32()
+			default:
+				size := 1
+				for limit := 256; size < 4 && t.size >= limit; limit <<= 8 {
+					size++
+				}
+				member.offset = int(b.uint(size))
+			}
+			datatype, err := parseDatatype(b)
+			if err != nil {
+				return t, err
+			}
+			member.datatype = datatype
+			t.members = append(t.members, member)
+		}
+	case hdf5VariableLen:
+		base, err := parseDatatype(b)
+		if err != nil {
+			return t, err
+		}
+		t.base = &base
+	default:
+		return t, fmt.Errorf("HDF5 datatype of class %d is not supported", t.class)
+	}
+	return t, b.err
+}
+
+// decode converts the raw data of fixed-point and floating-point types into
+// a typed slice
+func (t hdf5Type) decode(data []byte) (interface{}, error) {
+	if t.size <= 0 {
+		return nil, fmt.Errorf("Invalid size of HDF5 datatype: %d", t.size)
+	}
+	var dataType int
+	switch {
+	case t.class == hdf5FloatingPoint && t.size == 4:
+		dataType = MiSingle
+	case t.class == hdf5FloatingPoint && t.size == 8:
+		dataType = MiDouble
+	case t.class == hdf5FixedPoint && t.size == 1 && t.signed:
+		dataType = MiInt8
+	case t.class == hdf5FixedPoint && t.size == 1:
+		dataType = MiUint8
+	case t.class == hdf5FixedPoint && t.size == 2 && t.signed:
+		dataType = MiInt16
+	case t.class == hdf5FixedPoint && t.size == 2:
+		dataType = MiUint16
+	case t.class == hdf5FixedPoint && t.size == 4 && t.signed:
+		dataType = MiInt32
+	case t.class == hdf5FixedPoint && t.size == 4:
+		dataType = MiUint32
+	case t.class == hdf5FixedPoint && t.size == 8 && t.signed:
+		dataType = MiInt64
+	case t.class == hdf5FixedPoint && t.size == 8:
+		dataType = MiUint64
+	default:
+		return nil, fmt.Errorf("HDF5 datatype of class %d and size %d is not supported", t.class, t.size)
+	}
+	return decodeValues(t.order, dataType, data)
+}
+
+// hdf5Layout describes, where the raw data of a dataset is stored
+type hdf5Layout struct {
+	class   int
+	address uint64
+	data    []byte   // Raw data of compact datasets.
+	chunk   []uint64 // Size of the chunks, followed by the size of an element.
+}
+
+func parseLayout(b *hdf5Buffer) (hdf5Layout, error) {
+	var layout hdf5Layout
+	version := b.uint8()
+	switch version {
+	case 1, 2:
+		dimensionality := b.uint8()
+		layout.class = b.uint8()
+		b.skip(5)
+		if layout.class != hdf5Compact {
+			layout.address = b.address()
+		}
+		for i := 0; i < dimensionality; i++ {
+			layout.chunk = append(layout.chunk, uint64(b.uint32()))
+		}
+		if layout.class == hdf5Compact {
+			layout.data = b.bytes(b.uint32())
+		}
+	case 3:
+		layout.class = b.uint8()
+		switch layout.class {
+		case hdf5Compact:
+			layout.data = b.bytes(b.uint16())
+		case hdf5Contiguous:
+			layout.address = b.address()
+			b.length()
+		case hdf5Chunked:
+			dimensionality := b.uint8()
+			layout.address = b.address()
+			for i := 0; i < dimensionality; i++ {
+				layout.chunk = append(layout.chunk, uint64(b.uint32()))
+			}
+		}
+	default:
+		return layout, fmt.Errorf("Version %d of the HDF5 data layout is not supported", version)
+	}
+	if layout.class > hdf5Chunked {
+		return layout, fmt.Errorf("HDF5 data layout %d is not supported", layout.class)
+	}
+	return layout, b.err
+}
+
+// hdf5Filter is a filter of the filter pipeline of a chunked dataset
+type hdf5Filter struct {
+	id     int
+	values []int
+}
+
+func parseFilters(b *hdf5Buffer) ([]hdf5Filter, error) {
+	var filters []hdf5Filter
+	version := b.uint8()
+	numberOfFilters := b.uint8()
+	if version == 1 {
+		b.skip(6)
+	}
+	for i := 0; i < numberOfFilters && b.err == nil; i++ {
+		var filter hdf5Filter
+		filter.id = b.uint16()
+		var nameLength int
+		if version == 1 || filter.id >= 256 {
+			nameLength = b.uint16()
+		}
+		// Flags
+		b.skip(2)
+		numberOfValues := b.uint16()
+		b.skip(nameLength)
+		for j := 0; j < numberOfValues; j++ {
+			filter.values = append(filter.values, b.uint32())
+		}
+		if version == 1 && numberOfValues%2 == 1 {
+			b.skip(4)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, b.err
+}
+
+// unfilter reverts the filters of a chunk in reverse order, except the ones,
+// which are marked as skipped in mask. Inflated data may not exceed limit
+// bytes.
+func unfilter(data []byte, filters []hdf5Filter, mask int, limit uint64) ([]byte, error) {
+	for i := len(filters) - 1; i >= 0; i-- {
+		if mask&(1<<uint(i)) != 0 {
+			continue
+		}
+		switch filters[i].id {
+		case hdf5Deflate:
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, errors.Wrap(err, "\nzlib.NewReader() in unfilter() failed")
+			}
+			plain, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+			r.Close()
+			if err != nil {
+				return nil, errors.Wrap(err, "\nioutil.ReadAll() in unfilter() failed")
+			}
+			if uint64(len(plain)) > limit {
+				return nil, fmt.Errorf("Inflated chunk exceeds %d bytes", limit)
+			}
+			data = plain
+		case hdf5Shuffle:
+			size := 1
+			if len(filters[i].values) > 0 {
+				size = filters[i].values[0]
+			}
+			data = unshuffle(data, size)
+		case hdf5Fletcher32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("Chunk is too small for its checksum")
+			}
+			data = data[:len(data)-4]
+		default:
+			return nil, fmt.Errorf("HDF5 filter %d is not supported", filters[i].id)
+		}
+	}
+	return data, nil
+}
+
+// unshuffle reverts the shuffle filter, that groups the n-th bytes of all
+// elements together.
+func unshuffle(data []byte, size int) []byte {
+	if size <= 1 {
+		return data
+	}
+	elements := len(data) / size
+	plain := make([]byte, len(data))
+	for i := 0; i < elements; i++ {
+		for j := 0; j < size; j++ {
+			plain[i*size+j] = data[j*elements+i]
+		}
+	}
+	// Trailing bytes are not shuffled
+	copy(plain[elements*size:], data[elements*size:])
+	return plain
+}
+
+// hdf5Dataset contains the decoded messages of a dataset
+type hdf5Dataset struct {
+	space    hdf5Space
+	datatype hdf5Type
+	layout   hdf5Layout
+	filters  []hdf5Filter
+}
+
+func (f *hdf5File) dataset(o *hdf5Object) (hdf5Dataset, error) {
+	var d hdf5Dataset
+	var err error
+
+	b, ok := o.message(hdf5DataspaceMessage)
+	if !ok {
+		return d, fmt.Errorf("HDF5 object at %#x has no dataspace", o.address)
+	}
+	d.space = parseDataspace(b)
+	if b.err != nil {
+		return d, b.err
+	}
+	if b, ok = o.message(hdf5DatatypeMessage); !ok {
+		return d, fmt.Errorf("HDF5 object at %#x has no datatype", o.address)
+	}
+	if d.datatype, err = parseDatatype(b); err != nil {
+		return d, err
+	}
+	if b, ok = o.message(hdf5LayoutMessage); !ok {
+		return d, fmt.Errorf("HDF5 object at %#x has no data layout", o.address)
+	}
+	if d.layout, err = parseLayout(b); err != nil {
+		return d, err
+	}
+	if b, ok = o.message(hdf5FilterPipelineMessage); ok {
+		if d.filters, err = parseFilters(b); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+// read returns the raw data of a dataset
+func (f *hdf5File) read(d hdf5Dataset) ([]byte, error) {
+	size := d.space.elements * uint64(d.datatype.size)
+	if d.datatype.size <= 0 || (d.space.elements != 0 && size/d.space.elements != uint64(d.datatype.size)) || int64(size) < 0 {
+		return nil, fmt.Errorf("Invalid size of HDF5 dataset")
+	}
+
+	switch d.layout.class {
+	case hdf5Compact:
+		if uint64(len(d.layout.data)) < size {
+			return nil, fmt.Errorf("Compact HDF5 dataset contains %d of %d bytes", len(d.layout.data), size)
+		}
+		return d.layout.data[:size], nil
+	case hdf5Contiguous:
+		if d.layout.address == hdf5Undefined || size == 0 {
+			// Data was never written
+			return f.unwritten(size)
+		}
+		return f.readAt(d.layout.address, int(size))
+	}
+
+	rank := len(d.space.dims)
+	if len(d.layout.chunk) != rank+1 || rank == 0 {
+		return nil, fmt.Errorf("Chunks of %d dimensions do not match the dataset", len(d.layout.chunk))
+	}
+	if d.layout.chunk[rank] != uint64(d.datatype.size) {
+		return nil, fmt.Errorf("Chunks contain elements of %d instead of %d bytes", d.layout.chunk[rank], d.datatype.size)
+	}
+	if d.layout.address == hdf5Undefined {
+		return f.unwritten(size)
+	}
+	chunkSize := uint64(1)
+	for _, dim := range d.layout.chunk {
+		if dim == 0 || dim > math.MaxInt64/chunkSize {
+			return nil, fmt.Errorf("Invalid size of HDF5 chunks: %v", d.layout.chunk)
+		}
+		chunkSize *= dim
+	}
+	chunks, err := f.chunkIndex(d.layout.address, rank, maxBTreeDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	// Chunks can not contain more data than they inflate to
+	limit := chunkSize
+	for _, filter := range d.filters {
+		if filter.id == hdf5Fletcher32 {
+			limit += 4
+		}
+	}
+	var available uint64
+	for _, chunk := range chunks {
+		stored := uint64(chunk.size)
+		for i, filter := range d.filters {
+			if filter.id == hdf5Deflate && chunk.mask&(1<<uint(i)) == 0 {
+				stored *= maxDeflateRatio
+			}
+			if stored > chunkSize {
+				stored = chunkSize
+			}
+		}
+		available += stored
+	}
+	if size > available {
+		return nil, fmt.Errorf("HDF5 dataset of %d bytes exceeds the %d bytes of its chunks", size, available)
+	}
+
+	data := make([]byte, size)
+	for _, chunk := range chunks {
+		raw, err := f.readAt(chunk.address, chunk.size)
+		if err != nil {
+			return nil, err
+		}
+		if raw, err = unfilter(raw, d.filters, chunk.mask, limit); err != nil {
+			return nil, err
+		}
+		if err := copyChunk(data, d.space.dims, raw, d.layout.chunk, chunk.offsets); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// unwritten returns the data of a dataset, that was never written. Such data
+// is not allowed to exceed the size of the file.
+func (f *hdf5File) unwritten(size uint64) ([]byte, error) {
+	if size > uint64(f.size) {
+		return nil, fmt.Errorf("Unwritten HDF5 dataset of %d bytes exceeds the file", size)
+	}
+	return make([]byte, size), nil
+}
+
+// hdf5Chunk is an entry of the B-tree of a chunked dataset
+type hdf5Chunk struct {
+	offsets []uint64 // Position of the chunk in the dataset.
+	size    int      // Number of bytes of the filtered chunk in the file.
+	mask    int      // Filters, that are skipped for the chunk.
+	address uint64
+}
+
+// chunkIndex traverses the B-tree of a chunked dataset and returns its
+// chunks without reading them.
+func (f *hdf5File) chunkIndex(address uint64, rank, depth int) ([]hdf5Chunk, error) {
+	if depth <= 0 {
+		return nil, fmt.Errorf("B-tree of HDF5 dataset is too deep")
+	}
+	keySize := 8 + 8*(rank+1)
+	header := 8 + 2*f.offsets
+	b, err := f.readSignature(address, "TREE", header)
+	if err != nil {
+		return nil, err
+	}
+	nodeType := b.uint8()
+	level := b.uint8()
+	entries := b.uint16()
+	if nodeType != 1 {
+		return nil, fmt.Errorf("Expected B-tree of chunks, got type %d", nodeType)
+	}
+	data, err := f.readAt(address+uint64(header), entries*(keySize+f.offsets)+keySize)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []hdf5Chunk
+	b = &hdf5Buffer{f: f, data: data}
+	for i := 0; i < entries; i++ {
+		chunk := hdf5Chunk{size: b.uint32(), mask: b.uint32()}
+		for j := 0; j <= rank; j++ {
+			chunk.offsets = append(chunk.offsets, b.uint(8))
+		}
+		chunk.offsets = chunk.offsets[:rank]
+		chunk.address = b.address()
+		if b.err != nil {
+			return nil, b.err
+		}
+		if level > 0 {
+			children, err := f.chunkIndex(chunk.address, rank, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, children...)
+			continue
+		}
+		if chunk.address == hdf5Undefined || f.base+int64(chunk.address)+int64(chunk.size) > f.size || int64(chunk.address) < 0 {
+			return nil, fmt.Errorf("Invalid HDF5 address %#x of chunk", chunk.address)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// copyChunk copies the elements of a chunk, which start at offsets, into the
+// data of a dataset. Chunks at the edges of a dataset are not fully used.
+func copyChunk(data []byte, dims []uint64, chunk []byte, chunkDims []uint64, offsets []uint64) error {
+	rank := len(dims)
+	size := chunkDims[rank]
+	elements := size
+	for _, dim := range chunkDims[:rank] {
+		elements *= dim
+	}
+	if uint64(len(chunk)) < elements {
+		return fmt.Errorf("Chunk contains %d of %d bytes", len(chunk), elements)
+	}
+
+	// Copy each row of the last dimension at once
+	index := make([]uint64, rank)
+	for {
+		inside := true
+		var src, dst uint64
+		for k := 0; k < rank; k++ {
+			if offsets[k]+index[k] >= dims[k] {
+				inside = false
+			}
+			src = src*chunkDims[k] + index[k]
+			dst = dst*dims[k] + offsets[k] + index[k]
+		}
+		if inside {
+			n := chunkDims[rank-1]
+			if rest := dims[rank-1] - offsets[rank-1]; rest < n {
+				n = rest
+			}
+			copy(data[dst*size:(dst+n)*size], chunk[src*size:(src+n)*size])
+		}
+
+		// Next row
+		k := rank - 2
+		for ; k >= 0; k-- {
+			index[k]++
+			if index[k] < chunkDims[k] {
+				break
+			}
+			index[k] = 0
+		}
+		if k < 0 {
+			return nil
+		}
+	}
+}
+
+// hdf5Link is a named member of a group
+type hdf5Link struct {
+	name    string
+	address uint64
+}
+
+// links returns the members of a group, that uses a symbol table
+func (f *hdf5File) links(o *hdf5Object) ([]hdf5Link, error) {
+	b, ok := o.message(hdf5SymbolTableMessage)
+	if !ok {
+		return nil, fmt.Errorf("HDF5 object at %#x is not a group", o.address)
+	}
+	tree := b.address()
+	heapAddress := b.address()
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	heap, err := f.readSignature(heapAddress, "HEAP", 8+2*f.lengths+f.offsets)
+	if err != nil {
+		return nil, err
+	}
+	// Version and reserved
+	heap.skip(4)
+	heapSize := heap.length()
+	// Free list
+	heap.length()
+	names, err := f.readAt(heap.address(), int(heapSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var links []hdf5Link
+	err = f.readGroupNodes(tree, maxBTreeDepth, func(name, address uint64) error {
+		if name >= uint64(len(names)) {
+			return fmt.Errorf("Invalid offset of link name: %d", name)
+		}
+		n := &hdf5Buffer{data: names[name:]}
+		links = append(links, hdf5Link{name: n.cstring(), address: address})
+		return n.err
+	})
+	return links, err
+}
+
+// readGroupNodes traverses the B-tree of a group and calls fn for each entry
+// of its symbol table nodes.
+func (f *hdf5File) readGroupNodes(address uint64, depth int, fn func(name, address uint64) error) error {
+	if depth <= 0 {
+		return fmt.Errorf("B-tree of HDF5 group is too deep")
+	}
+	header := 8 + 2*f.offsets
+	b, err := f.readSignature(address, "TREE", header)
+	if err != nil {
+		return err
+	}
+	nodeType := b.uint8()
+	level := b.uint8()
+	entries := b.uint16()
+	if nodeType != 0 {
+		return fmt.Errorf("Expected B-tree of a group, got type %d", nodeType)
+	}
+	data, err := f.readAt(address+uint64(header), entries*(f.lengths+f.offsets)+f.lengths)
+	if err != nil {
+		return err
+	}
+	b = &hdf5Buffer{f: f, data: data}
+	for i := 0; i < entries; i++ {
+		// Key
+		b.length()
+		child := b.address()
+		if b.err != nil {
+			return b.err
+		}
+		if level > 0 {
+			if err := f.readGroupNodes(child, depth-1, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		node, err := f.readSignature(child, "SNOD", 8)
+		if err != nil {
+			return err
+		}
+		// Version and reserved
+		node.skip(2)
+		symbols := node.uint16()
+		data, err := f.readAt(child+8, symbols*f.symbolEntrySize())
+		if err != nil {
+			return err
+		}
+		entry := &hdf5Buffer{f: f, data: data}
+		for j := 0; j < symbols; j++ {
+			name, address := entry.symbolEntry()
+			if entry.err != nil {
+				return entry.err
+			}
+			if err := fn(name, address); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hdf5Attr is an attribute of a group or dataset
+type hdf5Attr struct {
+	space    hdf5Space
+	datatype hdf5Type
+	data     []byte
+}
+
+// attributes returns all attributes of an object
+func (f *hdf5File) attributes(o *hdf5Object) (map[string]hdf5Attr, error) {
+	attrs := make(map[string]hdf5Attr)
+	for _, message := range o.messages {
+		if message.kind != hdf5AttributeMessage {
+			continue
+		}
+		var attr hdf5Attr
+		var err error
+		b := &hdf5Buffer{f: f, data: message.data}
+		version := b.uint8()
+		b.skip(1)
+		nameSize := b.uint16()
+		datatypeSize := b.uint16()
+		dataspaceSize := b.uint16()
+		if version == 3 {
+			// Encoding of the name
+			b.skip(1)
+		}
+		padded := func(n int) int {
+			if version == 1 {
+				return (n + 7) &^ 7
+			}
+			return n
+		}
+		name := &hdf5Buffer{data: b.bytes(padded(nameSize))}
+		datatype := &hdf5Buffer{f: f, data: b.bytes(padded(datatypeSize))}
+		dataspace := &hdf5Buffer{f: f, data: b.bytes(padded(dataspaceSize))}
+		if b.err != nil {
+			return nil, b.err
+		}
+		if attr.datatype, err = parseDatatype(datatype); err != nil {
+			return nil, err
+		}
+		attr.space = parseDataspace(dataspace)
+		if dataspace.err != nil {
+			return nil, dataspace.err
+		}
+		size := attr.space.elements * uint64(attr.datatype.size)
+		if size > uint64(len(b.data)-b.pos) {
+			return nil, fmt.Errorf("Attribute contains %d of %d bytes", len(b.data)-b.pos, size)
+		}
+		attr.data = b.data[b.pos : b.pos+int(size)]
+		attrs[name.cstring()] = attr
+	}
+	return attrs, nil
+}
+
+// strings returns the values of an attribute of fixed or variable-length
+// strings.
+func (f *hdf5File) strings(attr hdf5Attr) ([]string, error) {
+	var strs []string
+	switch attr.datatype.class {
+	case hdf5String:
+		size := attr.datatype.size
+		for i := 0; i+size <= len(attr.data); i += size {
+			strs = append(strs, string(bytes.TrimRight(attr.data[i:i+size], "\x00 ")))
+		}
+	case hdf5VariableLen:
+		b := &hdf5Buffer{f: f, data: attr.data}
+		for i := uint64(0); i < attr.space.elements && b.err == nil; i++ {
+			length := b.uint32()
+			collection := b.address()
+			index := b.uint32()
+			if b.err != nil {
+				break
+			}
+			data, err := f.globalHeapObject(collection, index)
+			if err != nil {
+				return nil, err
+			}
+			if attr.datatype.base != nil && attr.datatype.base.size > 0 && length*attr.datatype.base.size <= len(data) {
+				data = data[:length*attr.datatype.base.size]
+			}
+			strs = append(strs, string(bytes.TrimRight(data, "\x00")))
+		}
+		if b.err != nil {
+			return nil, b.err
+		}
+	default:
+		return nil, fmt.Errorf("Expected HDF5 strings, got class %d", attr.datatype.class)
+	}
+	return strs, nil
+}
+
+// globalHeapObject returns an object of a global heap collection
+func (f *hdf5File) globalHeapObject(collection uint64, index int) ([]byte, error) {
+	b, err := f.readSignature(collection, "GCOL", 8+f.lengths)
+	if err != nil {
+		return nil, err
+	}
+	// Version and reserved
+	b.skip(4)
+	size := b.length()
+	data, err := f.readAt(collection, int(size))
+	if err != nil {
+		return nil, err
+	}
+	b = &hdf5Buffer{f: f, data: data, pos: 8 + f.lengths}
+	for b.pos+8+f.lengths <= len(data) {
+		id := b.uint16()
+		// Reference count and reserved
+		b.skip(6)
+		length := int(b.length())
+		object := b.bytes(length)
+		if b.err != nil || id == 0 {
+			break
+		}
+		if id == index {
+			return object, nil
+		}
+		b.align(0, 8)
+	}
+	return nil, fmt.Errorf("Object %d not found in global heap at %#x", index, collection)
+}
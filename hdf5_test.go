@@ -0,0 +1,290 @@
+package matf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"sort"
+	"testing"
+)
+
+// h5Builder assembles a minimal HDF5 file with the structures, MATLAB uses
+type h5Builder struct {
+	buf bytes.Buffer
+}
+
+// h5Link is a named member of a group
+type h5Link struct {
+	name    string
+	address uint64
+}
+
+const h5SuperblockSize = 96
+
+func newH5Builder() *h5Builder {
+	b := new(h5Builder)
+	b.buf.Write(make([]byte, h5SuperblockSize))
+	return b
+}
+
+func le(values ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, v := range values {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	return buf.Bytes()
+}
+
+func pad8(data []byte) []byte {
+	for len(data)%8 != 0 {
+		data = append(data, 0)
+	}
+	return data
+}
+
+// alloc appends data at the next address, that is a multiple of 8
+func (b *h5Builder) alloc(data []byte) uint64 {
+	b.buf.Write(make([]byte, (8-b.buf.Len()%8)%8))
+	address := uint64(b.buf.Len())
+	b.buf.Write(data)
+	return address
+}
+
+func h5Message(kind int, data []byte) []byte {
+	data = pad8(data)
+	return append(le(uint16(kind), uint16(len(data)), uint32(0)), data...)
+}
+
+// object stores an object header in version 1
+func (b *h5Builder) object(messages ...[]byte) uint64 {
+	var body []byte
+	for _, message := range messages {
+		body = append(body, message...)
+	}
+	header := le(uint8(1), uint8(0), uint16(len(messages)), uint32(1), uint32(len(body)), uint32(0))
+	return b.alloc(append(header, body...))
+}
+
+func h5Dataspace(dims ...uint64) []byte {
+	data := le(uint8(1), uint8(len(dims)), uint8(0), uint8(0), uint32(0))
+	for _, dim := range dims {
+		data = append(data, le(dim)...)
+	}
+	return h5Message(hdf5DataspaceMessage, data)
+}
+
+func h5Fixed(size int, signed bool) []byte {
+	var bits uint8
+	if signed {
+		bits = 0x08
+	}
+	return le(uint8(0x10|hdf5FixedPoint), bits, uint16(0), uint32(size), uint16(0), uint16(8*size))
+}
+
+func h5Float(size int) []byte {
+	if size == 4 {
+		return le(uint8(0x10|hdf5FloatingPoint), uint8(0x20), uint8(31), uint8(0), uint32(4),
+			uint16(0), uint16(32), uint8(23), uint8(8), uint8(0), uint8(23), uint32(127))
+	}
+	return le(uint8(0x10|hdf5FloatingPoint), uint8(0x20), uint8(63), uint8(0), uint32(8),
+		uint16(0), uint16(64), uint8(52), uint8(11), uint8(0), uint8(52), uint32(1023))
+}
+
+func h5String(size int) []byte {
+	return le(uint8(0x10|hdf5String), uint8(0), uint16(0), uint32(size))
+}
+
+func h5Reference() []byte {
+	return le(uint8(0x10|hdf5Reference), uint8(0), uint16(0), uint32(8))
+}
+
+// h5Complex returns a compound type of version 1 with the members real and imag
+func h5Complex(member []byte, size int) []byte {
+	data := le(uint8(0x10|hdf5Compound), uint16(2), uint8(0), uint32(2*size))
+	for i, name := range []string{"real", "imag"} {
+		data = append(data, pad8(append([]byte(name), 0))...)
+		data = append(data, le(uint32(i*size), uint8(0), [3]uint8{}, uint32(0), uint32(0), [4]uint32{})...)
+		data = append(data, member...)
+	}
+	return data
+}
+
+func h5VariableStrings() []byte {
+	return append(le(uint8(0x10|hdf5VariableLen), uint8(0), uint16(0), uint32(16)), h5String(1)...)
+}
+
+func h5Type(datatype []byte) []byte {
+	return h5Message(hdf5DatatypeMessage, datatype)
+}
+
+func h5Attribute(name string, datatype []byte, dims []uint64, data []byte) []byte {
+	space := le(uint8(1), uint8(len(dims)), uint8(0), uint8(0), uint32(0))
+	for _, dim := range dims {
+		space = append(space, le(dim)...)
+	}
+	nameData := append([]byte(name), 0)
+	message := le(uint8(1), uint8(0), uint16(len(nameData)), uint16(len(datatype)), uint16(len(space)))
+	message = append(message, pad8(nameData)...)
+	message = append(message, pad8(datatype)...)
+	message = append(message, pad8(space)...)
+	message = append(message, data...)
+	return h5Message(hdf5AttributeMessage, message)
+}
+
+func h5Class(name string) []byte {
+	return h5Attribute("MATLAB_class", h5String(len(name)), nil, []byte(name))
+}
+
+func h5Contiguous(address uint64, size int) []byte {
+	return h5Message(hdf5LayoutMessage, le(uint8(3), uint8(hdf5Contiguous), address, uint64(size)))
+}
+
+// dataset stores a dataset with contiguous layout
+func (b *h5Builder) dataset(datatype []byte, dims []uint64, data []byte, attrs ...[]byte) uint64 {
+	address := b.alloc(data)
+	messages := append([][]byte{h5Dataspace(dims...), h5Type(datatype), h5Contiguous(address, len(data))}, attrs...)
+	return b.object(messages...)
+}
+
+// chunked stores a deflated dataset of two dimensions, that is split into
+// chunks of chunkDims.
+func (b *h5Builder) chunked(t *testing.T, datatype []byte, size int, dims, chunkDims []uint64, data []byte, attrs ...[]byte) uint64 {
+	var keys [][]byte
+	var children []uint64
+	for i := uint64(0); i < dims[0]; i += chunkDims[0] {
+		for j := uint64(0); j < dims[1]; j += chunkDims[1] {
+			chunk := make([]byte, int(chunkDims[0]*chunkDims[1])*size)
+			for k := uint64(0); k < chunkDims[0] && i+k < dims[0]; k++ {
+				for l := uint64(0); l < chunkDims[1] && j+l < dims[1]; l++ {
+					src := ((i+k)*dims[1] + j + l) * uint64(size)
+					dst := (k*chunkDims[1] + l) * uint64(size)
+					copy(chunk[dst:dst+uint64(size)], data[src:src+uint64(size)])
+				}
+			}
+			compressed, err := compressData(chunk, zlib.DefaultCompression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			children = append(children, b.alloc(compressed))
+			keys = append(keys, le(uint32(len(compressed)), uint32(0), i, j, uint64(0)))
+		}
+	}
+	tree := le([]byte("TREE"), uint8(1), uint8(0), uint16(len(children)), hdf5Undefined, hdf5Undefined)
+	for i, key := range keys {
+		tree = append(tree, key...)
+		tree = append(tree, le(children[i])...)
+	}
+	tree = append(tree, le(uint32(0), uint32(0), dims[0], dims[1], uint64(0))...)
+	address := b.alloc(tree)
+
+	layout := h5Message(hdf5LayoutMessage, le(uint8(3), uint8(hdf5Chunked), uint8(3), address, uint32(chunkDims[0]), uint32(chunkDims[1]), uint32(size)))
+	filters := h5Message(hdf5FilterPipelineMessage, le(uint8(1), uint8(1), [6]uint8{}, uint16(hdf5Deflate), uint16(0), uint16(0), uint16(1), uint32(6), uint32(0)))
+	messages := append([][]byte{h5Dataspace(dims...), h5Type(datatype), layout, filters}, attrs...)
+	return b.object(messages...)
+}
+
+// group stores a group with a symbol table
+func (b *h5Builder) group(links []h5Link, attrs ...[]byte) uint64 {
+	sorted := append([]h5Link{}, links...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	heap := make([]byte, 8)
+	var entries []byte
+	var last uint64
+	for _, link := range sorted {
+		last = uint64(len(heap))
+		heap = append(heap, pad8(append([]byte(link.name), 0))...)
+		entries = append(entries, le(last, link.address, uint32(0), uint32(0), [16]uint8{})...)
+	}
+	heapData := b.alloc(heap)
+	heapAddress := b.alloc(le([]byte("HEAP"), uint8(0), [3]uint8{}, uint64(len(heap)), hdf5Undefined, heapData))
+	node := b.alloc(append(le([]byte("SNOD"), uint8(1), uint8(0), uint16(len(sorted))), entries...))
+	tree := b.alloc(le([]byte("TREE"), uint8(0), uint8(0), uint16(1), hdf5Undefined, hdf5Undefined, uint64(0), node, last))
+
+	messages := append([][]byte{h5Message(hdf5SymbolTableMessage, le(tree, heapAddress))}, attrs...)
+	return b.object(messages...)
+}
+
+// strings stores variable-length strings in a global heap and returns their
+// references.
+func (b *h5Builder) strings(strs ...string) []byte {
+	var objects []byte
+	for i, str := range strs {
+		objects = append(objects, le(uint16(i+1), uint16(1), uint32(0), uint64(len(str)))...)
+		objects = append(objects, pad8([]byte(str))...)
+	}
+	collection := b.alloc(append(le([]byte("GCOL"), uint8(1), [3]uint8{}, uint64(16+len(objects))), objects...))
+	var refs []byte
+	for i, str := range strs {
+		refs = append(refs, le(uint32(len(str)), collection, uint32(i+1))...)
+	}
+	return refs
+}
+
+// finish writes the superblock and returns the MAT-file with the root group
+func (b *h5Builder) finish(root uint64) []byte {
+	data := b.buf.Bytes()
+	superblock := le(hdf5Signature, [8]uint8{0, 0, 0, 0, 0, 8, 8, 0}, uint16(4), uint16(16), uint32(0),
+		uint64(0), hdf5Undefined, uint64(len(data)), hdf5Undefined,
+		uint64(0), root, uint32(0), uint32(0), [16]uint8{})
+	copy(data, superblock)
+
+	header := make([]byte, 512)
+	copy(header, bytes.Repeat([]byte{' '}, 116))
+	copy(header, "MATLAB 7.3 MAT-file, Platform: GLNXA64, Created on: Mon Jan  1 00:00:00 2024 HDF5 schema 1.00 .")
+	copy(header[124:], []byte{0x00, 0x02, 'I', 'M'})
+	return append(header, data...)
+}
+
+func TestCopyChunk(t *testing.T) {
+	t.Parallel()
+
+	// A 3x3 dataset with a 2x2 chunk at its lower right corner
+	data := make([]byte, 9)
+	chunk := []byte{1, 2, 3, 4}
+	if err := copyChunk(data, []uint64{3, 3}, chunk, []uint64{2, 2, 1}, []uint64{2, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{0, 0, 0, 0, 0, 0, 0, 0, 1}) {
+		t.Fatalf("Unexpected data: %v", data)
+	}
+	if err := copyChunk(data, []uint64{3, 3}, chunk[:3], []uint64{2, 2, 1}, []uint64{0, 0}); err == nil {
+		t.Fatalf("Expected error for short chunk")
+	}
+}
+
+func TestUnfilter(t *testing.T) {
+	t.Parallel()
+
+	compressed, err := compressData([]byte{1, 3, 5, 2, 4, 6, 0xFF}, zlib.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := []hdf5Filter{{id: hdf5Shuffle, values: []int{2}}, {id: hdf5Deflate}}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		mask   int
+		limit  uint64
+		output []byte
+		err    bool
+	}{
+		{name: "ShuffleDeflate", data: compressed, limit: 7, output: []byte{1, 2, 3, 4, 5, 6, 0xFF}},
+		{name: "SkipDeflate", data: []byte{1, 3, 5, 2, 4, 6}, mask: 2, limit: 6, output: []byte{1, 2, 3, 4, 5, 6}},
+		{name: "Corrupt", data: []byte{1, 2, 3}, limit: 6, err: true},
+		{name: "ExceedsLimit", data: compressed, limit: 6, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := unfilter(tc.data, filters, tc.mask, tc.limit)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !tc.err && !bytes.Equal(output, tc.output) {
+				t.Fatalf("Expected: %v\tGot: %v", tc.output, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,602 @@
+package matf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Parameters of the B-trees, that are written
+const (
+	hdf5GroupLeafK     = 4  // Symbol table nodes contain up to 2K entries.
+	hdf5GroupInternalK = 16 // Nodes of the B-tree of a group contain up to 2K children.
+	hdf5ChunkK         = 32 // Nodes of the B-tree of a dataset contain up to 2K chunks.
+)
+
+// hdf5SuperblockSize is the size of a superblock in version 0 with 8 byte
+// addresses and lengths.
+const hdf5SuperblockSize = 96
+
+// hdf5ChunkSize limits the size of a chunk of a dataset in bytes
+const hdf5ChunkSize = 1 << 20
+
+// hdf5Encoder encodes the little-endian fields of HDF5 structures
+type hdf5Encoder struct {
+	bytes.Buffer
+}
+
+func (e *hdf5Encoder) uint(value uint64, size int) {
+	for i := 0; i < size; i++ {
+		e.WriteByte(byte(value >> (8 * uint(i))))
+	}
+}
+
+func (e *hdf5Encoder) uint8(value int)     { e.uint(uint64(value), 1) }
+func (e *hdf5Encoder) uint16(value int)    { e.uint(uint64(value), 2) }
+func (e *hdf5Encoder) uint32(value int)    { e.uint(uint64(value), 4) }
+func (e *hdf5Encoder) uint64(value uint64) { e.uint(value, 8) }
+
+// pad appends zeros up to the next multiple of 8 relative to start
+func (e *hdf5Encoder) pad(start int) {
+	for (e.Len()-start)%8 != 0 {
+		e.WriteByte(0)
+	}
+}
+
+// hdf5Writer appends HDF5 structures with 8 byte addresses and lengths to a
+// file. All addresses are relative to the superblock at base.
+type hdf5Writer struct {
+	w         io.WriterAt
+	base      int64
+	end       uint64 // Next free address.
+	chunkSize int    // Maximum size of a chunk in bytes.
+}
+
+func newHDF5Writer(w io.WriterAt, base int64) *hdf5Writer {
+	// Space for the superblock is reserved, as it is written last
+	return &hdf5Writer{w: w, base: base, end: hdf5SuperblockSize, chunkSize: hdf5ChunkSize}
+}
+
+// alloc writes data at the next free address, that is a multiple of 8
+func (h *hdf5Writer) alloc(data []byte) (uint64, error) {
+	address := (h.end + 7) &^ 7
+	if _, err := h.w.WriteAt(data, h.base+int64(address)); err != nil {
+		return 0, errors.Wrap(err, "\nWriteAt() in alloc() failed")
+	}
+	h.end = address + uint64(len(data))
+	return address, nil
+}
+
+// encodeMessage encodes a message of an object header in version 1
+func encodeMessage(kind int, data []byte) []byte {
+	var e hdf5Encoder
+	e.uint16(kind)
+	e.uint16((len(data) + 7) &^ 7)
+	// Flags and reserved
+	e.uint32(0)
+	e.Write(data)
+	e.pad(0)
+	return e.Bytes()
+}
+
+// writeObject writes an object header in version 1
+func (h *hdf5Writer) writeObject(messages [][]byte) (uint64, error) {
+	var e hdf5Encoder
+	var size int
+	for _, message := range messages {
+		size += len(message)
+	}
+	e.uint8(1)
+	e.uint8(0)
+	e.uint16(len(messages))
+	// Reference count
+	e.uint32(1)
+	e.uint32(size)
+	e.uint32(0)
+	for _, message := range messages {
+		e.Write(message)
+	}
+	return h.alloc(e.Bytes())
+}
+
+// encodeDataspace encodes a simple dataspace in version 1. A dataspace
+// without dimensions describes a scalar.
+func encodeDataspace(dims []uint64) []byte {
+	var e hdf5Encoder
+	e.uint8(1)
+	e.uint8(len(dims))
+	// Flags, reserved
+	e.uint8(0)
+	e.uint8(0)
+	e.uint32(0)
+	for _, dim := range dims {
+		e.uint64(dim)
+	}
+	return e.Bytes()
+}
+
+// encode encodes a datatype in version 1
+func (t hdf5Type) encode() []byte {
+	var e hdf5Encoder
+	e.uint8(0x10 | t.class)
+	switch t.class {
+	case hdf5FixedPoint:
+		bits := 0
+		if t.signed {
+			bits = 0x08
+		}
+		e.uint(uint64(bits), 3)
+		e.uint32(t.size)
+		// Bit offset and precision
+		e.uint16(0)
+		e.uint16(8 * t.size)
+	case hdf5FloatingPoint:
+		// Implied mantissa normalization and location of the sign bit
+		e.uint(uint64(0x20|(8*t.size-1)<<8), 3)
+		e.uint32(t.size)
+		e.uint16(0)
+		e.uint16(8 * t.size)
+		if t.size == 4 {
+			e.Write([]byte{23, 8, 0, 23})
+			e.uint32(127)
+		} else {
+			e.Write([]byte{52, 11, 0, 52})
+			e.uint32(1023)
+		}
+	case hdf5String, hdf5Reference:
+		e.uint(0, 3)
+		e.uint32(t.size)
+	case hdf5Compound:
+		e.uint(uint64(len(t.members)), 3)
+		e.uint32(t.size)
+		for _, member := range t.members {
+			start := e.Len()
+			e.WriteString(member.name)
+			e.WriteByte(0)
+			e.pad(start)
+			e.uint32(member.offset)
+			// Dimensionality, reserved, permutation, reserved and dimension sizes
+			e.Write(make([]byte, 28))
+			e.Write(member.datatype.encode())
+		}
+	case hdf5VariableLen:
+		e.uint(0, 3)
+		e.uint32(t.size)
+		e.Write(t.base.encode())
+	}
+	return e.Bytes()
+}
+
+// encodeAttribute encodes an attribute message in version 1
+func encodeAttribute(name string, t hdf5Type, dims []uint64, data []byte) []byte {
+	var e hdf5Encoder
+	datatype := t.encode()
+	dataspace := encodeDataspace(dims)
+	e.uint8(1)
+	e.uint8(0)
+	e.uint16(len(name) + 1)
+	e.uint16(len(datatype))
+	e.uint16(len(dataspace))
+	start := e.Len()
+	e.WriteString(name)
+	e.WriteByte(0)
+	e.pad(start)
+	e.Write(datatype)
+	e.pad(start)
+	e.Write(dataspace)
+	e.pad(start)
+	e.Write(data)
+	return encodeMessage(hdf5AttributeMessage, e.Bytes())
+}
+
+// writeDataset writes a dataset. If level is not zlib.NoCompression, the
+// data is split into chunks, which are compressed with deflate.
+func (h *hdf5Writer) writeDataset(t hdf5Type, dims []uint64, data []byte, level int, attrs [][]byte) (uint64, error) {
+	var e hdf5Encoder
+	messages := [][]byte{
+		encodeMessage(hdf5DataspaceMessage, encodeDataspace(dims)),
+		encodeMessage(hdf5DatatypeMessage, t.encode()),
+	}
+
+	elements := uint64(1)
+	for _, dim := range dims {
+		elements *= dim
+	}
+	if level == zlib.NoCompression || len(dims) == 0 || elements == 0 {
+		address := hdf5Undefined
+		if len(data) > 0 {
+			var err error
+			if address, err = h.alloc(data); err != nil {
+				return 0, err
+			}
+		}
+		e.uint8(3)
+		e.uint8(hdf5Contiguous)
+		e.uint64(address)
+		e.uint64(uint64(len(data)))
+		messages = append(messages, encodeMessage(hdf5LayoutMessage, e.Bytes()))
+		return h.writeObject(append(messages, attrs...))
+	}
+
+	chunk := chunkDims(dims, t.size, h.chunkSize)
+	tree, err := h.writeChunks(dims, chunk, t.size, data, level)
+	if err != nil {
+		return 0, err
+	}
+	e.uint8(3)
+	e.uint8(hdf5Chunked)
+	e.uint8(len(dims) + 1)
+	e.uint64(tree)
+	for _, dim := range chunk {
+		e.uint32(int(dim))
+	}
+	e.uint32(t.size)
+	messages = append(messages, encodeMessage(hdf5LayoutMessage, e.Bytes()))
+
+	// Filter pipeline in version 1 with deflate
+	var filters hdf5Encoder
+	filters.uint8(1)
+	filters.uint8(1)
+	filters.Write(make([]byte, 6))
+	filters.uint16(hdf5Deflate)
+	// Length of the name, flags and number of values
+	filters.uint16(0)
+	filters.uint16(0)
+	filters.uint16(1)
+	filters.uint32(deflateLevel(level))
+	filters.uint32(0)
+	messages = append(messages, encodeMessage(hdf5FilterPipelineMessage, filters.Bytes()))
+
+	return h.writeObject(append(messages, attrs...))
+}
+
+// deflateLevel returns the aggression level of the deflate filter for a zlib
+// level. The HDF5 library only accepts the levels 0 to 9, so the negative
+// levels zlib.DefaultCompression and zlib.HuffmanOnly are stored as zlib's
+// default level 6.
+func deflateLevel(level int) int {
+	if level < 0 {
+		return 6
+	}
+	return level
+}
+
+// chunkDims halves the largest dimension of a chunk, until it does not
+// exceed limit bytes.
+func chunkDims(dims []uint64, size, limit int) []uint64 {
+	chunk := append([]uint64{}, dims...)
+	for {
+		bytes := uint64(size)
+		largest := 0
+		for i, dim := range chunk {
+			bytes *= dim
+			if dim > chunk[largest] {
+				largest = i
+			}
+		}
+		if bytes <= uint64(limit) || chunk[largest] == 1 {
+			return chunk
+		}
+		chunk[largest] = (chunk[largest] + 1) / 2
+	}
+}
+
+// extractChunk returns the elements of the chunk at offsets. Chunks at the
+// edges of a dataset are filled with zeros.
+func extractChunk(data []byte, dims []uint64, chunkDims []uint64, size uint64, offsets []uint64) []byte {
+	rank := len(dims)
+	elements := size
+	for _, dim := range chunkDims {
+		elements *= dim
+	}
+	chunk := make([]byte, elements)
+
+	// Copy each row of the last dimension at once
+	index := make([]uint64, rank)
+	for {
+		inside := true
+		var src, dst uint64
+		for k := 0; k < rank; k++ {
+			if offsets[k]+index[k] >= dims[k] {
+				inside = false
+			}
+			dst = dst*chunkDims[k] + index[k]
+			src = src*dims[k] + offsets[k] + index[k]
+		}
+		if inside {
+			n := chunkDims[rank-1]
+			if rest := dims[rank-1] - offsets[rank-1]; rest < n {
+				n = rest
+			}
+			copy(chunk[dst*size:(dst+n)*size], data[src*size:(src+n)*size])
+		}
+
+		k := rank - 2
+		for ; k >= 0; k-- {
+			index[k]++
+			if index[k] < chunkDims[k] {
+				break
+			}
+			index[k] = 0
+		}
+		if k < 0 {
+			return chunk
+		}
+	}
+}
+
+// writeChunks writes the compressed chunks of a dataset and the B-tree, that
+// indexes them.
+func (h *hdf5Writer) writeChunks(dims, chunk []uint64, size int, data []byte, level int) (uint64, error) {
+	rank := len(dims)
+	var keys [][]byte
+	var children []uint64
+
+	offsets := make([]uint64, rank)
+	for {
+		raw := extractChunk(data, dims, chunk, uint64(size), offsets)
+		compressed, err := compressData(raw, level)
+		if err != nil {
+			return 0, errors.Wrap(err, "\ncompressData() in writeChunks() failed")
+		}
+		// Chunks, that do not benefit from compression, skip the filter
+		mask := 0
+		if len(compressed) >= len(raw) {
+			compressed, mask = raw, 1
+		}
+		address, err := h.alloc(compressed)
+		if err != nil {
+			return 0, err
+		}
+		children = append(children, address)
+		keys = append(keys, encodeChunkKey(len(compressed), mask, offsets))
+
+		k := rank - 1
+		for ; k >= 0; k-- {
+			offsets[k] += chunk[k]
+			if offsets[k] < dims[k] {
+				break
+			}
+			offsets[k] = 0
+		}
+		if k < 0 {
+			break
+		}
+	}
+
+	// The last key is beyond all chunks
+	last := make([]uint64, rank)
+	last[0] = (dims[0] + chunk[0] - 1) / chunk[0] * chunk[0]
+	keys = append(keys, encodeChunkKey(0, 0, last))
+	return h.writeBTree(1, hdf5ChunkK, keys, children)
+}
+
+func encodeChunkKey(size, mask int, offsets []uint64) []byte {
+	var e hdf5Encoder
+	e.uint32(size)
+	e.uint32(mask)
+	for _, offset := range offsets {
+		e.uint64(offset)
+	}
+	// Offset in the dimension of the element size
+	e.uint64(0)
+	return e.Bytes()
+}
+
+// writeBTree writes a B-tree in version 1 over children. Each child i is
+// described by the keys i and i+1. It returns the address of the root node.
+func (h *hdf5Writer) writeBTree(nodeType, k int, keys [][]byte, children []uint64) (uint64, error) {
+	keySize := len(keys[0])
+	nodeSize := 8 + 2*8 + (2*k+1)*keySize + 2*k*8
+	for level := 0; ; level++ {
+		numberOfNodes := (len(children) + 2*k - 1) / (2 * k)
+		if numberOfNodes == 0 {
+			numberOfNodes = 1
+		}
+		// Siblings are written next to each other
+		start := (h.end + 7) &^ 7
+		var e hdf5Encoder
+		var parentKeys [][]byte
+		var parents []uint64
+		for i := 0; i < numberOfNodes; i++ {
+			first := i * 2 * k
+			last := first + 2*k
+			if last > len(children) {
+				last = len(children)
+			}
+			nodeStart := e.Len()
+			e.WriteString("TREE")
+			e.uint8(nodeType)
+			e.uint8(level)
+			e.uint16(last - first)
+			left, right := hdf5Undefined, hdf5Undefined
+			if i > 0 {
+				left = start + uint64((i-1)*nodeSize)
+			}
+			if i < numberOfNodes-1 {
+				right = start + uint64((i+1)*nodeSize)
+			}
+			e.uint64(left)
+			e.uint64(right)
+			for j := first; j < last; j++ {
+				e.Write(keys[j])
+				e.uint64(children[j])
+			}
+			e.Write(keys[last])
+			e.Write(make([]byte, nodeSize-(e.Len()-nodeStart)))
+
+			parentKeys = append(parentKeys, keys[first])
+			parents = append(parents, start+uint64(i*nodeSize))
+		}
+		if _, err := h.alloc(e.Bytes()); err != nil {
+			return 0, err
+		}
+		if numberOfNodes == 1 {
+			return parents[0], nil
+		}
+		keys = append(parentKeys, keys[len(keys)-1])
+		children = parents
+	}
+}
+
+// writeGroup writes a group with a symbol table. It returns the addresses of
+// its object header, B-tree and local heap.
+func (h *hdf5Writer) writeGroup(links []hdf5Link, attrs [][]byte) (uint64, uint64, uint64, error) {
+	sorted := append([]hdf5Link{}, links...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	// The local heap starts with an empty string, which is the first key
+	var heap hdf5Encoder
+	heap.Write(make([]byte, 8))
+	offsets := make([]uint64, len(sorted))
+	for i, link := range sorted {
+		offsets[i] = uint64(heap.Len())
+		heap.WriteString(link.name)
+		heap.WriteByte(0)
+		heap.pad(0)
+	}
+	heapData, err := h.alloc(heap.Bytes())
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var e hdf5Encoder
+	e.WriteString("HEAP")
+	e.uint32(0)
+	e.uint64(uint64(heap.Len()))
+	// There is no free block in the heap
+	e.uint64(1)
+	e.uint64(heapData)
+	heapAddress, err := h.alloc(e.Bytes())
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	// Symbol table nodes with up to 2K entries
+	keys := [][]byte{make([]byte, 8)}
+	var nodes []uint64
+	entries := 2 * hdf5GroupLeafK
+	for first := 0; first < len(sorted); first += entries {
+		last := first + entries
+		if last > len(sorted) {
+			last = len(sorted)
+		}
+		var node hdf5Encoder
+		node.WriteString("SNOD")
+		node.uint8(1)
+		node.uint8(0)
+		node.uint16(last - first)
+		for i := first; i < last; i++ {
+			node.uint64(offsets[i])
+			node.uint64(sorted[i].address)
+			// Cache type, reserved and scratch-pad space
+			node.Write(make([]byte, 24))
+		}
+		node.Write(make([]byte, 8+entries*40-node.Len()))
+		address, err := h.alloc(node.Bytes())
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		nodes = append(nodes, address)
+		var key hdf5Encoder
+		key.uint64(offsets[last-1])
+		keys = append(keys, key.Bytes())
+	}
+	tree, err := h.writeBTree(0, hdf5GroupInternalK, keys, nodes)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var table hdf5Encoder
+	table.uint64(tree)
+	table.uint64(heapAddress)
+	messages := append([][]byte{encodeMessage(hdf5SymbolTableMessage, table.Bytes())}, attrs...)
+	address, err := h.writeObject(messages)
+	return address, tree, heapAddress, err
+}
+
+// writeStrings stores strings in a global heap collection and returns the
+// data of a variable-length string attribute, that references them.
+func (h *hdf5Writer) writeStrings(strs []string) ([]byte, error) {
+	var objects hdf5Encoder
+	for i, str := range strs {
+		objects.uint16(i + 1)
+		// Reference count and reserved
+		objects.uint16(1)
+		objects.uint32(0)
+		objects.uint64(uint64(len(str)))
+		start := objects.Len()
+		objects.WriteString(str)
+		objects.pad(start)
+	}
+	// Collections have a minimum size of 4096 bytes, the rest is free space
+	size := 16 + objects.Len() + 16
+	if size < 4096 {
+		size = 4096
+	}
+	var e hdf5Encoder
+	e.WriteString("GCOL")
+	e.uint8(1)
+	e.Write(make([]byte, 3))
+	e.uint64(uint64(size))
+	e.Write(objects.Bytes())
+	free := size - e.Len()
+	e.uint16(0)
+	e.uint16(0)
+	e.uint32(0)
+	e.uint64(uint64(free))
+	e.Write(make([]byte, free-16))
+	collection, err := h.alloc(e.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var refs hdf5Encoder
+	for i, str := range strs {
+		refs.uint32(len(str))
+		refs.uint64(collection)
+		refs.uint32(i + 1)
+	}
+	return refs.Bytes(), nil
+}
+
+// writeSuperblock writes the superblock in version 0 in front of all other
+// structures.
+func (h *hdf5Writer) writeSuperblock(root, tree, heap uint64) error {
+	var e hdf5Encoder
+	e.Write(hdf5Signature)
+	// Versions of the superblock, free-space storage, root group symbol
+	// table entry and shared header messages, size of offsets and lengths
+	e.Write([]byte{0, 0, 0, 0, 0, 8, 8, 0})
+	e.uint16(hdf5GroupLeafK)
+	e.uint16(hdf5GroupInternalK)
+	e.uint32(0)
+	// Base address, free-space info, end of file and driver information
+	e.uint64(uint64(h.base))
+	e.uint64(hdf5Undefined)
+	e.uint64(h.end)
+	e.uint64(hdf5Undefined)
+	// Symbol table entry of the root group, that caches its symbol table
+	e.uint64(0)
+	e.uint64(root)
+	e.uint32(1)
+	e.uint32(0)
+	e.uint64(tree)
+	e.uint64(heap)
+	if e.Len() != hdf5SuperblockSize {
+		return fmt.Errorf("Superblock has %d instead of %d bytes", e.Len(), hdf5SuperblockSize)
+	}
+	if _, err := h.w.WriteAt(e.Bytes(), h.base); err != nil {
+		return errors.Wrap(err, "\nWriteAt() in writeSuperblock() failed")
+	}
+	return nil
+}
+
+// newHDF5Type returns a fixed-point or floating-point datatype
+func newHDF5Type(class, size int, signed bool) hdf5Type {
+	return hdf5Type{class: class, size: size, order: binary.LittleEndian, signed: signed}
+}
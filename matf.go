@@ -16,7 +16,7 @@ import (
 
 // Basic binary flags for various array types
 const (
-	ClassMask   = 0x0F    // Mask to extract the containing class from an array.
+	ClassMask   = 0xFF    // Mask to extract the containing class from an array.
 	FlagComplex = 1 << 11 // If set, the data element contains an imaginary part.
 	FlagGlobal  = 1 << 10 // MATLAB uses this element on global scope.
 	FlagLogical = 1 << 9  // Array is used for logical indexing.
@@ -25,19 +25,25 @@ const (
 // Matf represents the MAT-file
 type Matf struct {
 	Header
-	file         *os.File
-	byteSwapping bool
+	file            *io.SectionReader // Provides sequential and random access to the MAT-file.
+	closer          io.Closer         // Closes the file, that was opened by Open.
+	byteSwapping    bool
+	offset          int64               // Current position in the MAT-file.
+	subsystemOffset int64               // Position of the subsystem data, 0 if there is none.
+	subsystem       *Subsystem          // Parsed subsystem data, see Subsystem().
+	version4        bool                // Level 4 MAT-files do not have a header.
+	v73             *v73Reader          // Reads MAT-files in version 7.3, which are based on HDF5.
+	index           map[string]Variable // Variables by their name, see Get().
 }
 
-// Dim contains the dimensions of a MatMatrix
-type Dim struct {
-	X, Y, Z int
-}
+// Dim contains the size of each dimension of a MatMatrix
+type Dim []int
 
 // NumPrt contains the numeric part of a matrix
 type NumPrt struct {
-	RealPart      interface{}
-	ImaginaryPart interface{}
+	RealPart      interface{} // Typed slice like []float64 or []int32, depending on the class of the matrix.
+	ImaginaryPart interface{} // Slice of the same kind as RealPart, only set for complex matrices. The Writer also accepts []complex128 or []complex64 in RealPart instead.
+	DataType      int         // Data type like MiUint8, that the values are stored with in the MAT-file.
 }
 
 // StructPrt represents a matf struct
@@ -56,13 +62,37 @@ type CharPrt struct {
 	Chars []string
 }
 
+// ObjectPrt represents a matf object, created with the class() function
+type ObjectPrt struct {
+	ClassName string
+	Fields    StructPrt
+}
+
+// OpaquePrt represents a matf opaque object, like the objects of the MATLAB
+// Class Object System (MCOS). Their actual content is stored in the subsystem
+// data of the MAT-file.
+type OpaquePrt struct {
+	TypeSystem string    // Type system of the object, usually MCOS.
+	ClassName  string    // Name of the class of the object.
+	Metadata   MatMatrix // References the object, see Subsystem.Resolve().
+}
+
+// SparsePrt represents a matf sparse matrix in compressed sparse column format
+type SparsePrt struct {
+	RowIndex      []int // Row of each nonzero element.
+	ColumnPointer []int // Index of the first nonzero element of each column and the total number of nonzero elements.
+	NzMax         int   // Maximum number of nonzero elements.
+	RealPart      interface{}
+	ImaginaryPart interface{}
+}
+
 // MatMatrix represents a matrix
 type MatMatrix struct {
 	Name  string
 	Flags uint32
 	Class uint32
 	Dim
-	Content interface{} // Can contain NumPrt, StructPrt, CellPrt or CharPrt - depending on the value in Class.
+	Content interface{} // Can contain NumPrt, StructPrt, CellPrt, CharPrt, ObjectPrt, OpaquePrt or SparsePrt - depending on the value in Class. Decoded MCOS objects contain StringPrt, Table, Datetime, Duration, CalendarDuration, Categorical or ContainersMap.
 }
 
 // Header contains informations about the MAT-file
@@ -73,11 +103,22 @@ type Header struct {
 	EndianIndicator     uint16 // Indicates, if the file was written on a Big Endian or Little Endian system.
 }
 
-func readHeader(mat *Matf, file *os.File) error {
+func readHeader(mat *Matf, file *io.SectionReader) error {
 	data := make([]byte, 128)
-	count, err := file.Read(data)
-	if err != nil {
-		return errors.Wrap(err, "\nfile.Read() in readHeader() failed")
+	count, err := io.ReadFull(file, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return errors.Wrap(err, "\nio.ReadFull() in readHeader() failed")
+	}
+
+	// Level 4 MAT-files start with the header of their first matrix
+	if order, ok := detectV4(data[:count]); ok {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, "\nfile.Seek() in readHeader() failed")
+		}
+		mat.version4 = true
+		mat.byteSwapping = order == binary.LittleEndian
+		mat.offset = 0
+		return nil
 	}
 
 	if count != 128 {
@@ -93,26 +134,35 @@ func readHeader(mat *Matf, file *os.File) error {
 		// EndianIndicator is IM rather than MI
 		mat.byteSwapping = true
 	}
+	mat.offset = 128
+	mat.subsystemOffset = readSubsystemOffset(mat.Header.SubsystemDataOffset, mat.order())
+
+	// MAT-files in version 7.3 continue with HDF5 after a 512 byte header
+	if mat.order().Uint16(data[124:126]) == 0x0200 {
+		var err error
+		if mat.v73, err = newV73Reader(file, file.Size()); err != nil {
+			return errors.Wrap(err, "\nnewV73Reader() in readHeader() failed")
+		}
+		mat.subsystemOffset = 0
+	}
 
 	return nil
 }
 
 func readDimensions(data interface{}) (Dim, error) {
+	if data == nil || reflect.ValueOf(data).Kind() != reflect.Slice {
+		return Dim{}, fmt.Errorf("Dimensions of type %T are not supported", data)
+	}
+	values, err := ints(data)
+	if err != nil {
+		return Dim{}, errors.Wrap(err, "\nints() in readDimensions() failed")
+	}
 	var dim Dim
-	t := reflect.ValueOf(data)
-
-	for i := 0; i < t.Len(); i++ {
-		value := reflect.ValueOf(t.Index(i).Interface()).Int()
-		switch i {
-		case 0:
-			dim.X = int(value)
-		case 1:
-			dim.Y = int(value)
-		case 2:
-			dim.Z = int(value)
-		default:
-			return Dim{}, fmt.Errorf("More dimensions than exptected")
+	for i, value := range values {
+		if value < 0 {
+			return Dim{}, fmt.Errorf("Invalid size of dimension %d: %d", i, value)
 		}
+		dim = append(dim, value)
 	}
 	return dim, nil
 }
@@ -127,13 +177,53 @@ func alignIndex(r io.Reader, order binary.ByteOrder, index int) int {
 	}
 }
 
-func extractClass(mat *MatMatrix, r io.Reader, order binary.ByteOrder) (int, error) {
+func extractStruct(r io.Reader, order binary.ByteOrder, numberOfElements int) (StructPrt, int, error) {
+	var elements = make(map[string][]interface{})
+	var content StructPrt
+	var index int
+	data, err := readMatfBytes(r, order, 16)
+	if err != nil {
+		return StructPrt{}, 0, fmt.Errorf("Unable to read %d bytes: %v", 16, err)
+	}
+	// Field Name Length
+	fieldNameLength := order.Uint32(data[index+4 : index+8])
+	if fieldNameLength == 0 {
+		return StructPrt{}, 0, fmt.Errorf("Invalid field name length: %d", fieldNameLength)
+	}
+	// Field Names
+	numberOfFields := order.Uint32(data[index+12:index+16]) / fieldNameLength
+	index = alignIndex(r, order, index+16)
+	fieldNames, err := extractFieldNames(r, order, int(fieldNameLength), int(numberOfFields))
+	if err != nil {
+		return StructPrt{}, 0, err
+	}
+	content.FieldNames = fieldNames
+	index = alignIndex(r, order, index+(int(numberOfFields)*int(fieldNameLength)))
+	// Field Values
+	toExtract := (numberOfElements * int(numberOfFields))
+	var i int
+	for ; toExtract > 0; toExtract-- {
+		var element interface{}
+		dataType, numberOfBytes, offset, _ := extractTag(r, order)
+		element, _, err = extractDataElement(r, order, int(dataType), int(numberOfBytes))
+		if err != nil {
+			return StructPrt{}, 0, err
+		}
+		index = alignIndex(r, order, index+offset+int(numberOfBytes))
+		elements[fieldNames[i]] = append(elements[fieldNames[i]], element)
+		i = (i + 1) % int(numberOfFields)
+	}
+	content.FieldValues = elements
+	return content, index, nil
+}
+
+func extractClass(mat *MatMatrix, r io.Reader, order binary.ByteOrder, nzmax int) (int, error) {
 	var index int
 
 	switch int(mat.Class) {
 	case MxCellClass:
 		var content CellPrt
-		var maxElements = mat.Dim.Y
+		var maxElements = mat.NumElements()
 		var noElements int
 		for {
 			if noElements >= maxElements {
@@ -151,64 +241,37 @@ func extractClass(mat *MatMatrix, r io.Reader, order binary.ByteOrder) (int, err
 		}
 		mat.Content = content
 	case MxStructClass:
-		var elements = make(map[string][]interface{})
-		var content StructPrt
-		data, err := readMatfBytes(r, order, 16)
+		content, used, err := extractStruct(r, order, mat.NumElements())
 		if err != nil {
-			return 0, fmt.Errorf("Unable to read %d bytes: %v", 16, err)
-		}
-		// Field Name Length
-		fieldNameLength := order.Uint32(data[index+4 : index+8])
-		// Field Names
-		numberOfFields := order.Uint32(data[index+12:index+16]) / fieldNameLength
-		index = alignIndex(r, order, index+16)
-		fieldNames, err := extractFieldNames(r, order, int(fieldNameLength), int(numberOfFields))
+			return 0, err
+		}
+		index = alignIndex(r, order, index+used)
+		mat.Content = content
+	case MxObjectClass:
+		var content ObjectPrt
+		className, used, err := extractArrayName(r, order)
 		if err != nil {
 			return 0, err
 		}
-		content.FieldNames = fieldNames
-		index = alignIndex(r, order, index+(int(numberOfFields)*int(fieldNameLength)))
-		// Field Values
-		toExtract := (mat.Dim.Y * int(numberOfFields))
-		var i int
-		for ; toExtract > 0; toExtract-- {
-			var element interface{}
-			dataType, numberOfBytes, offset, _ := extractTag(r, order)
-			element, _, err = extractDataElement(r, order, int(dataType), int(numberOfBytes))
-			if err != nil {
-				return 0, err
-			}
-			index = alignIndex(r, order, index+offset+int(numberOfBytes))
-			elements[fieldNames[i]] = append(elements[fieldNames[i]], element)
-			i = (i + 1) % int(numberOfFields)
+		content.ClassName = className
+		index = alignIndex(r, order, index+used)
+		fields, used, err := extractStruct(r, order, mat.NumElements())
+		if err != nil {
+			return 0, err
 		}
-		content.FieldValues = elements
+		content.Fields = fields
+		index = alignIndex(r, order, index+used)
 		mat.Content = content
 	case MxCharClass:
 		var content CharPrt
-		var maxElements = mat.Dim.X
-
-		element, numberOfBytes, err := extractArrayName(r, order)
+		chars, numberOfBytes, err := extractChars(r, order)
 		if err != nil {
 			return 0, err
 		}
-		index = alignIndex(r, order, index+numberOfBytes+8)
-		if maxElements > 1 {
-			// Split the elements
-			elements := make(map[int][]byte)
-			var mapIndex int
-			for i, v := range element {
-				if i%2 != 0 {
-					continue
-				}
-				elements[mapIndex%maxElements] = append(elements[mapIndex%maxElements], byte(v))
-				mapIndex++
-			}
-			for _, v := range elements {
-				content.Chars = append(content.Chars, string(v))
-			}
-		} else {
-			content.Chars = append(content.Chars, element)
+		index = alignIndex(r, order, index+numberOfBytes)
+		content.Chars, err = charRows(chars, mat.Dim)
+		if err != nil {
+			return 0, errors.Wrap(err, "\ncharRows() in extractClass() failed")
 		}
 		mat.Content = content
 	case MxDoubleClass:
@@ -226,19 +289,112 @@ func extractClass(mat *MatMatrix, r io.Reader, order binary.ByteOrder) (int, err
 	case MxInt32Class:
 		fallthrough
 	case MxUint32Class:
+		fallthrough
+	case MxInt64Class:
+		fallthrough
+	case MxUint64Class:
 		var content NumPrt
+		var err error
+		dataType := classDataType[int(mat.Class)]
 		// Real part
-		re, used, _ := extractNumeric(r, order)
-		content.RealPart = re
+		re, used, err := extractNumeric(r, order)
+		if err != nil {
+			return 0, errors.Wrap(err, "\nextractNumeric() in extractClass() failed")
+		}
+		content.DataType = valuesDataType(re)
+		if content.RealPart, err = promoteValues(re, dataType); err != nil {
+			return 0, errors.Wrap(err, "\npromoteValues() in extractClass() failed")
+		}
 		index = alignIndex(r, order, index+used)
 		// Imaginary part (optional)
 		if FlagComplex&mat.Flags == FlagComplex {
-			im, used, _ := extractNumeric(r, order)
-			content.ImaginaryPart = im
+			im, used, err := extractNumeric(r, order)
+			if err != nil {
+				return 0, errors.Wrap(err, "\nextractNumeric() in extractClass() failed")
+			}
+			if content.ImaginaryPart, err = promoteValues(im, dataType); err != nil {
+				return 0, errors.Wrap(err, "\npromoteValues() in extractClass() failed")
+			}
 			index += used
 			index = alignIndex(r, order, index)
 		}
 		mat.Content = content
+	case MxOpaqueClass:
+		var content OpaquePrt
+		typeSystem, used, err := extractArrayName(r, order)
+		if err != nil {
+			return 0, err
+		}
+		content.TypeSystem = typeSystem
+		index = alignIndex(r, order, index+used)
+		className, used, err := extractArrayName(r, order)
+		if err != nil {
+			return 0, err
+		}
+		content.ClassName = className
+		index = alignIndex(r, order, index+used)
+		dataType, numberOfBytes, offset, err := extractTag(r, order)
+		if err != nil {
+			return 0, errors.Wrap(err, "\nextractTag() in extractClass() failed")
+		}
+		if int(dataType) != MiMatrix {
+			return 0, fmt.Errorf("Unexpected data type %d for metadata of opaque object", dataType)
+		}
+		metadata, _, err := extractDataElement(r, order, int(dataType), int(numberOfBytes))
+		if err != nil {
+			return 0, err
+		}
+		content.Metadata = metadata.(MatMatrix)
+		index = alignIndex(r, order, index+offset+int(numberOfBytes))
+		mat.Content = content
+	case MxSparseClass:
+		var content SparsePrt
+		var err error
+		content.NzMax = nzmax
+		// Row indices
+		ir, used, err := extractNumeric(r, order)
+		if err != nil {
+			return 0, errors.Wrap(err, "\nextractNumeric() in extractClass() failed")
+		}
+		if content.RowIndex, err = ints(ir); err != nil {
+			return 0, errors.Wrap(err, "\nints() in extractClass() failed")
+		}
+		index = alignIndex(r, order, index+used)
+		// Column pointers
+		jc, used, err := extractNumeric(r, order)
+		if err != nil {
+			return 0, errors.Wrap(err, "\nextractNumeric() in extractClass() failed")
+		}
+		if content.ColumnPointer, err = ints(jc); err != nil {
+			return 0, errors.Wrap(err, "\nints() in extractClass() failed")
+		}
+		index = alignIndex(r, order, index+used)
+		// Real part
+		re, used, err := extractNumeric(r, order)
+		if err != nil {
+			return 0, errors.Wrap(err, "\nextractNumeric() in extractClass() failed")
+		}
+		// Sparse arrays are either logical or double
+		if FlagLogical&mat.Flags == FlagLogical {
+			if content.RealPart, err = bools(re); err != nil {
+				return 0, errors.Wrap(err, "\nbools() in extractClass() failed")
+			}
+		} else if content.RealPart, err = promoteValues(re, MiDouble); err != nil {
+			return 0, errors.Wrap(err, "\npromoteValues() in extractClass() failed")
+		}
+		index = alignIndex(r, order, index+used)
+		// Imaginary part (optional)
+		if FlagComplex&mat.Flags == FlagComplex {
+			im, used, err := extractNumeric(r, order)
+			if err != nil {
+				return 0, errors.Wrap(err, "\nextractNumeric() in extractClass() failed")
+			}
+			if content.ImaginaryPart, err = promoteValues(im, MiDouble); err != nil {
+				return 0, errors.Wrap(err, "\npromoteValues() in extractClass() failed")
+			}
+			index = alignIndex(r, order, index+used)
+		}
+		mat.Content = content
 	default:
 		return 0, fmt.Errorf("This type of class is not supported yet: %d", mat.Class)
 	}
@@ -246,7 +402,10 @@ func extractClass(mat *MatMatrix, r io.Reader, order binary.ByteOrder) (int, err
 	return index, nil
 }
 
-func extractMatrix(r io.Reader, order binary.ByteOrder) (MatMatrix, int, error) {
+// extractMatrixHeader extracts the array flags, dimensions and name of a
+// matrix. It returns the matrix without content, its maximum number of
+// nonzero elements and the number of bytes, that were used.
+func extractMatrixHeader(r io.Reader, order binary.ByteOrder) (MatMatrix, int, int, error) {
 	var matrix MatMatrix
 	var index int
 	var offset int
@@ -257,39 +416,59 @@ func extractMatrix(r io.Reader, order binary.ByteOrder) (MatMatrix, int, error)
 	// Array Flags
 	_, numberOfBytes, offset, err = extractTag(r, order)
 	if err != nil {
-		return MatMatrix{}, 0, errors.Wrap(err, "\nextractTag() in extractMatrix() failed:")
+		return MatMatrix{}, 0, 0, errors.Wrap(err, "\nextractTag() in extractMatrixHeader() failed:")
 	}
 	index = alignIndex(r, order, index+offset+int(numberOfBytes))
 
 	arrayFlags, err := readMatfBytes(r, order, int(numberOfBytes))
 	if err != nil {
-		return MatMatrix{}, 0, errors.Wrap(err, "\nreadMatfBytes() in extractMatrix() failed:")
+		return MatMatrix{}, 0, 0, errors.Wrap(err, "\nreadMatfBytes() in extractMatrixHeader() failed:")
 	}
 	matrix.Flags = order.Uint32(arrayFlags)
-	matrix.Class = matrix.Flags & 0x0F
+	// The second word of the array flags is only used by sparse arrays
+	var nzmax int
+	if len(arrayFlags) >= 8 {
+		nzmax = int(order.Uint32(arrayFlags[4:8]))
+	}
+	matrix.Class = matrix.Flags & ClassMask
 	index = alignIndex(r, order, index+offset+int(numberOfBytes))
 
-	// Dimensions Array
-	dataType, numberOfBytes, offset, err = extractTag(r, order)
-	if err != nil {
-		return MatMatrix{}, 0, errors.Wrap(err, "\nextractTag() in extractMatrix() failed:")
-	}
-	dims, _, err := extractDataElement(r, order, int(dataType), int(numberOfBytes))
-	if err != nil {
-		return MatMatrix{}, 0, errors.Wrap(err, "\nextractDataElement() in extractMatrix() failed:")
+	// Opaque objects do not have a dimensions array
+	if int(matrix.Class) != MxOpaqueClass {
+		// Dimensions Array
+		dataType, numberOfBytes, offset, err = extractTag(r, order)
+		if err != nil {
+			return MatMatrix{}, 0, 0, errors.Wrap(err, "\nextractTag() in extractMatrixHeader() failed:")
+		}
+		dims, _, err := extractDataElement(r, order, int(dataType), int(numberOfBytes))
+		if err != nil {
+			return MatMatrix{}, 0, 0, errors.Wrap(err, "\nextractDataElement() in extractMatrixHeader() failed:")
+		}
+		matrix.Dim, err = readDimensions(dims)
+		if err != nil {
+			return MatMatrix{}, 0, 0, errors.Wrap(err, "\nreadDimensions() in extractMatrixHeader() failed:")
+		}
+		index = alignIndex(r, order, index+offset+int(numberOfBytes))
 	}
-	matrix.Dim, _ = readDimensions(dims)
-	index = alignIndex(r, order, index+offset+int(numberOfBytes))
 
 	// Array Name
 	arrayName, step, err := extractArrayName(r, order)
 	if err != nil {
-		return MatMatrix{}, 0, errors.Wrap(err, "\nextractArrayName() in extractMatrix() failed:")
+		return MatMatrix{}, 0, 0, errors.Wrap(err, "\nextractArrayName() in extractMatrixHeader() failed:")
 	}
 	matrix.Name = arrayName
 	index = alignIndex(r, order, index+step)
 
-	steps, err := extractClass(&matrix, r, order)
+	return matrix, nzmax, index, nil
+}
+
+func extractMatrix(r io.Reader, order binary.ByteOrder) (MatMatrix, int, error) {
+	matrix, nzmax, index, err := extractMatrixHeader(r, order)
+	if err != nil {
+		return MatMatrix{}, 0, errors.Wrap(err, "\nextractMatrixHeader() in extractMatrix() failed:")
+	}
+
+	steps, err := extractClass(&matrix, r, order, nzmax)
 	if err != nil {
 		return MatMatrix{}, 0, errors.Wrap(err, "\nextractClass() in extractMatrix() failed:")
 	}
@@ -308,6 +487,7 @@ func readBytes(m *Matf, numberOfBytes int) ([]byte, error) {
 			return nil, err
 		}
 		index += count
+		m.offset += int64(count)
 		if index >= numberOfBytes || count == 0 {
 			break
 		}
@@ -318,86 +498,91 @@ func readBytes(m *Matf, numberOfBytes int) ([]byte, error) {
 	return data, nil
 }
 
-func decompressData(data []byte) ([]byte, error) {
-	tmp := bytes.NewReader(data)
-	var out bytes.Buffer
-	r, err := zlib.NewReader(tmp)
-	if err != nil {
-		return []byte{}, errors.Wrap(err, "\nzlib.NewReader() in decompressData() failed")
-	}
-	defer r.Close()
-	if r != nil {
-		io.Copy(&out, r)
-	}
-	return out.Bytes(), err
-}
-
 func readDataElementField(m *Matf, order binary.ByteOrder) (MatMatrix, error) {
-	var mat MatMatrix
-	var data []byte
-	var dataType, completeBytes uint32
+	start := m.offset
 	tag, err := readBytes(m, 8)
 	if err != nil {
 		return MatMatrix{}, err
 	}
 
-	dataType = order.Uint32(tag[:4])
-	completeBytes = order.Uint32(tag[4:8])
-	data, err = readBytes(m, int(completeBytes))
-	if err != nil {
-		return MatMatrix{}, errors.Wrap(err, "\nreadBytes() in readDataElementField() failed")
+	dataType := order.Uint32(tag[:4])
+	completeBytes := order.Uint32(tag[4:8])
+	if m.offset+int64(completeBytes) > m.file.Size() {
+		return MatMatrix{}, fmt.Errorf("Data element of %d bytes exceeds the end of the file", completeBytes)
 	}
-
-	if dataType == uint32(MiCompressed) {
-		plain, err := decompressData(data[:completeBytes])
-		if err != nil {
-			return MatMatrix{}, errors.Wrap(err, "\ndecompressData() in readDataElementField() failed")
-		}
-		dataType = order.Uint32(plain[:4])
-		completeBytes = order.Uint32(plain[4:8])
-		if err != nil {
-			return MatMatrix{}, errors.Wrap(err, "\nextractTag() in readDataElementField() failed")
-		}
-		data = plain[8:]
+	element := io.NewSectionReader(m.file, m.offset, int64(completeBytes))
+	// The next data element follows regardless of how much of this one is used
+	if _, err := m.file.Seek(int64(completeBytes), io.SeekCurrent); err != nil {
+		return MatMatrix{}, errors.Wrap(err, "\nfile.Seek() in readDataElementField() failed")
 	}
+	m.offset += int64(completeBytes)
 
-	tmpfile, err := ioutil.TempFile("", "matf")
-	if err != nil {
-		return MatMatrix{}, errors.Wrap(err, "\nioutil.TempFile() in readDataElementField() failed")
+	if m.subsystemOffset != 0 && start == m.subsystemOffset {
+		// The subsystem data is not a variable of its own
+		return readDataElementField(m, order)
 	}
 
-	defer func() {
-		tmpfile.Close()
-		os.Remove(tmpfile.Name())
-	}()
+	return parseDataElementField(order, dataType, completeBytes, element)
+}
 
-	if _, err = tmpfile.Write(data); err != nil {
-		return MatMatrix{}, errors.Wrap(err, "\nos.Write() in readDataElementField() failed")
+// parseDataElementField extracts the data element of dataType from r.
+// Compressed data elements are inflated while they are extracted.
+func parseDataElementField(order binary.ByteOrder, dataType, completeBytes uint32, r io.Reader) (MatMatrix, error) {
+	var mat MatMatrix
+	if dataType == uint32(MiCompressed) {
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return MatMatrix{}, errors.Wrap(err, "\nzlib.NewReader() in parseDataElementField() failed")
+		}
+		defer zr.Close()
+		tag := make([]byte, 8)
+		if _, err := io.ReadFull(zr, tag); err != nil {
+			return MatMatrix{}, errors.Wrap(err, "\nio.ReadFull() in parseDataElementField() failed")
+		}
+		dataType = order.Uint32(tag[:4])
+		completeBytes = order.Uint32(tag[4:8])
+		r = zr
 	}
-	tmpfile.Seek(0, 0)
-	r := bufio.NewReader(tmpfile)
 
-	element, i, err := extractDataElement(r, order, int(dataType), int(completeBytes))
+	// Data elements within this one can not exceed its size
+	limited := &io.LimitedReader{R: bufio.NewReader(r), N: int64(completeBytes)}
+	element, i, err := extractDataElement(limited, order, int(dataType), int(completeBytes))
 	if err != nil {
-		return MatMatrix{}, errors.Wrap(err, "\nextractDataElement() in readDataElementField() failed")
+		return MatMatrix{}, errors.Wrap(err, "\nextractDataElement() in parseDataElementField() failed")
 	}
 	if int(dataType) == MiMatrix {
 		mat = element.(MatMatrix)
 	}
 
 	for uint32(i) < completeBytes {
-		return mat, fmt.Errorf("readDataElementField() could not extract all information")
+		return mat, fmt.Errorf("parseDataElementField() could not extract all information")
 	}
 
 	return mat, nil
 }
 
-// Dimensions returns the dimensions of a matrix
-func (m MatMatrix) Dimensions() (int, int, int, error) {
-	return m.Dim.X, m.Dim.Y, m.Dim.Z, nil
+// Dimensions returns the size of each dimension of a matrix
+func (m MatMatrix) Dimensions() ([]int, error) {
+	return append([]int{}, m.Dim...), nil
+}
+
+// NumElements returns the number of elements, described by the dimensions
+func (d Dim) NumElements() int {
+	if len(d) == 0 {
+		return 0
+	}
+	elements := 1
+	for _, size := range d {
+		elements *= size
+	}
+	return elements
 }
 
 // Open a MAT-file and extracts the header information into the Header struct.
+// Level 4 MAT-files are detected by the header of their first matrix. As they
+// do not have a file header, Header stays empty for them.
+// MAT-files in version 7.3 are HDF5 files. They are read with the subset of
+// HDF5, that MATLAB uses for them.
 func Open(file string) (*Matf, error) {
 	if info, err := os.Stat(file); err == nil && info.IsDir() {
 		return nil, fmt.Errorf("%s is not a file", file)
@@ -407,29 +592,95 @@ func Open(file string) (*Matf, error) {
 	if err != nil {
 		return nil, err
 	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	mat, err := NewReaderAt(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "\nNewReaderAt() in Open() failed")
+	}
+	mat.closer = f
+
+	return mat, nil
+}
 
+// NewReaderAt reads a MAT-file of size bytes from r, like Open does.
+func NewReaderAt(r io.ReaderAt, size int64) (*Matf, error) {
 	mat := new(Matf)
-	mat.file = f
+	mat.file = io.NewSectionReader(r, 0, size)
 
-	err = readHeader(mat, f)
-	if err != nil {
-		return nil, errors.Wrap(err, "\nreadHeader() in Open() failed")
+	if err := readHeader(mat, mat.file); err != nil {
+		return nil, errors.Wrap(err, "\nreadHeader() in NewReaderAt() failed")
 	}
 
 	return mat, nil
 }
 
+// OpenBytes reads a MAT-file from memory, like Open does.
+func OpenBytes(data []byte) (*Matf, error) {
+	return NewReaderAt(bytes.NewReader(data), int64(len(data)))
+}
+
+// NewReader reads a MAT-file from r, like Open does. The subsystem data at
+// the end of a MAT-file and MAT-files in version 7.3 need random access, so
+// the whole content of r is read into memory. Use NewReaderAt to avoid this.
+func NewReader(r io.Reader) (*Matf, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nioutil.ReadAll() in NewReader() failed")
+	}
+	return OpenBytes(data)
+}
+
+// order returns the byte order of the MAT-file
+func (m *Matf) order() binary.ByteOrder {
+	if m.byteSwapping {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
 // ReadDataElement returns the next data element.
 // It returns io.EOF, if no further elements are available
 func ReadDataElement(file *Matf) (MatMatrix, error) {
-	if file.byteSwapping {
-		return readDataElementField(file, binary.LittleEndian)
+	if file.version4 {
+		return readV4Matrix(file, file.order())
+	}
+	var mat MatMatrix
+	var err error
+	if file.v73 != nil {
+		mat, err = file.v73.readNext()
+	} else {
+		mat, err = readDataElementField(file, file.order())
+	}
+	if err != nil || !hasObjects(mat) {
+		return mat, err
 	}
-	return readDataElementField(file, binary.BigEndian)
+	return decodeObjects(file, mat)
+}
 
+// decodeObjects decodes the MCOS objects in mat with the help of the
+// subsystem data.
+func decodeObjects(file *Matf, mat MatMatrix) (MatMatrix, error) {
+	s, err := file.Subsystem()
+	if err != nil {
+		return MatMatrix{}, errors.Wrap(err, "\nSubsystem() in decodeObjects() failed")
+	}
+	if s == nil {
+		return mat, nil
+	}
+	return s.decodeObjects(mat, 0)
 }
 
-// Close a MAT-file
+// Close a MAT-file. MAT-files, that were not opened by Open, do not need to
+// be closed.
 func Close(file *Matf) error {
-	return file.file.Close()
+	if file.closer == nil {
+		return nil
+	}
+	return file.closer.Close()
 }
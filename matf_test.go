@@ -2,13 +2,16 @@ package matf
 
 import (
 	"bytes"
+	"compress/zlib"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"regexp"
 	"testing"
+	"testing/iotest"
 )
 
 var (
@@ -162,6 +165,21 @@ func TestOpen(t *testing.T) {
 	}
 }
 
+// decompressData inflates the zlib compressed data
+func decompressData(data []byte) ([]byte, error) {
+	tmp := bytes.NewReader(data)
+	var out bytes.Buffer
+	r, err := zlib.NewReader(tmp)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer r.Close()
+	if r != nil {
+		io.Copy(&out, r)
+	}
+	return out.Bytes(), err
+}
+
 func TestDecompressData(t *testing.T) {
 	t.Parallel()
 
@@ -192,25 +210,77 @@ func TestDecompressData(t *testing.T) {
 	}
 }
 
+func TestParseDataElementField(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	mat := MatMatrix{Name: "x", Flags: uint32(MxDoubleClass), Class: uint32(MxDoubleClass), Dim: Dim{1, 2},
+		Content: NumPrt{RealPart: []float64{1, 2}, DataType: MiDouble}}
+	if err := packMatrix(&buf, mat, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := compressData(buf.Bytes(), zlib.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The real part claims more bytes than the compressed element contains
+	oversized := append([]byte{}, buf.Bytes()...)
+	tag := bytes.Index(oversized, []byte{byte(MiDouble), 0, 0, 0, 16, 0, 0, 0})
+	binary.LittleEndian.PutUint32(oversized[tag+4:], 0x7FFFFFF0)
+	oversized, err = compressData(oversized, zlib.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		dataType int
+		data     []byte
+		err      bool
+	}{
+		{name: "Plain", dataType: MiMatrix, data: buf.Bytes()[8:]},
+		{name: "Compressed", dataType: MiCompressed, data: compressed},
+		{name: "Corrupt", dataType: MiCompressed, data: buf.Bytes(), err: true},
+		{name: "Truncated", dataType: MiCompressed, data: compressed[:len(compressed)/2], err: true},
+		{name: "Oversized", dataType: MiCompressed, data: oversized, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Data is inflated and extracted while it is read
+			r := iotest.OneByteReader(bytes.NewReader(tc.data))
+			element, err := parseDataElementField(binary.LittleEndian, uint32(tc.dataType), uint32(len(tc.data)), r)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if !tc.err && !reflect.DeepEqual(element, mat) {
+				t.Fatalf("Expected: %#v\nGot: %#v", mat, element)
+			}
+		})
+	}
+}
+
 func TestDimensions(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
-		name string
-		mat  MatMatrix
-		x    int
-		y    int
-		z    int
-		err  string
+		name     string
+		mat      MatMatrix
+		dims     []int
+		elements int
+		err      string
 	}{
-		{name: "1 Dim", mat: MatMatrix{Dim: Dim{X: 2, Y: 0, Z: 0}}, x: 2},
-		{name: "2 Dim", mat: MatMatrix{Dim: Dim{X: 3, Y: 5, Z: 0}}, x: 3, y: 5},
-		{name: "3 Dim", mat: MatMatrix{Dim: Dim{X: 7, Y: 11, Z: 13}}, x: 7, y: 11, z: 13},
+		{name: "No Dim", mat: MatMatrix{}, dims: []int{}},
+		{name: "1 Dim", mat: MatMatrix{Dim: Dim{2}}, dims: []int{2}, elements: 2},
+		{name: "2 Dim", mat: MatMatrix{Dim: Dim{3, 5}}, dims: []int{3, 5}, elements: 15},
+		{name: "3 Dim", mat: MatMatrix{Dim: Dim{7, 11, 13}}, dims: []int{7, 11, 13}, elements: 1001},
+		{name: "5 Dim", mat: MatMatrix{Dim: Dim{2, 3, 4, 5, 6}}, dims: []int{2, 3, 4, 5, 6}, elements: 720},
+		{name: "Empty", mat: MatMatrix{Dim: Dim{0, 3}}, dims: []int{0, 3}},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			x, y, z, err := tc.mat.Dimensions()
+			dims, err := tc.mat.Dimensions()
 			if err != nil {
 				if matched, _ := regexp.MatchString(tc.err, err.Error()); !matched {
 					t.Fatalf("Error matching regex: %v \t Got: %v", tc.err, err)
@@ -221,12 +291,11 @@ func TestDimensions(t *testing.T) {
 			} else if len(tc.err) != 0 {
 				t.Fatalf("Expected error, got none")
 			}
-			if tc.x != x {
-				t.Fatalf("Expected x: %d\tgot: %d", tc.x, x)
-			} else if tc.y != y {
-				t.Fatalf("Expected y: %d\tgot: %d", tc.y, y)
-			} else if tc.z != z {
-				t.Fatalf("Expected z: %d\tgot: %d", tc.x, z)
+			if !reflect.DeepEqual(tc.dims, dims) {
+				t.Fatalf("Expected dims: %v\tgot: %v", tc.dims, dims)
+			}
+			if elements := tc.mat.NumElements(); tc.elements != elements {
+				t.Fatalf("Expected elements: %d\tgot: %d", tc.elements, elements)
 			}
 		})
 	}
@@ -272,7 +341,8 @@ func TestReadDimensions(t *testing.T) {
 	}{
 		{name: " 1", data: []interface{}{1, 1}},
 		{name: " 2", data: []interface{}{2, 1, 2}},
-		{name: " 3", data: []interface{}{3, 1, 2, 3}, err: "More dimensions than exptected"},
+		{name: " 3", data: []interface{}{3, 1, 2, 3}},
+		{name: "Negative", data: []interface{}{1, -1}, err: "Invalid size of dimension"},
 	}
 
 	for _, tc := range tests {
@@ -360,3 +430,245 @@ func TestMatf(t *testing.T) {
 		})
 	}
 }
+
+func TestReaders(t *testing.T) {
+	t.Parallel()
+
+	open := map[string]func([]byte) (*Matf, error){
+		"OpenBytes": OpenBytes,
+		"NewReader": func(data []byte) (*Matf, error) {
+			return NewReader(iotest.OneByteReader(bytes.NewReader(data)))
+		},
+		"NewReaderAt": func(data []byte) (*Matf, error) {
+			return NewReaderAt(bytes.NewReader(data), int64(len(data)))
+		},
+	}
+
+	for name, fn := range open {
+		t.Run(name, func(t *testing.T) {
+			if _, err := fn(noMatf); err == nil {
+				t.Fatalf("Expected error, got none")
+			}
+			x, err := fn(compressedMatf)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			defer Close(x)
+			var count int
+			for {
+				_, err := ReadDataElement(x)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("Could not read data element: %v", err)
+				}
+				count++
+			}
+			if count == 0 {
+				t.Fatalf("Expected data elements, got none")
+			}
+		})
+	}
+}
+
+// packNumeric stores values as data element of dataType
+func packNumeric(buf *bytes.Buffer, order binary.ByteOrder, dataType int, values interface{}) error {
+	data, err := packValues(order, dataType, values)
+	if err != nil {
+		return err
+	}
+	packDataElement(buf, order, dataType, data)
+	return nil
+}
+
+func packSparse(flags uint32, nzmax int, ir, jc []int32, pr, pi interface{}) []byte {
+	var body, buf bytes.Buffer
+	order := binary.LittleEndian
+
+	arrayFlags := make([]byte, 8)
+	order.PutUint32(arrayFlags[:4], flags|uint32(MxSparseClass))
+	order.PutUint32(arrayFlags[4:], uint32(nzmax))
+	packDataElement(&body, order, MiUint32, arrayFlags)
+	packNumeric(&body, order, MiInt32, []int32{3, 3})
+	packDataElement(&body, order, MiInt8, []byte("sparse"))
+	packNumeric(&body, order, MiInt32, ir)
+	packNumeric(&body, order, MiInt32, jc)
+	packNumeric(&body, order, valuesDataType(pr), pr)
+	if pi != nil {
+		packNumeric(&body, order, valuesDataType(pi), pi)
+	}
+	packTag(&buf, order, MiMatrix, body.Len())
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+func TestExtractSparse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		data    []byte
+		content SparsePrt
+		err     bool
+	}{
+		{name: "Real", data: packSparse(0, 4, []int32{0, 2, 1}, []int32{0, 1, 2, 3}, []float64{1, 2, 3}, nil),
+			content: SparsePrt{RowIndex: []int{0, 2, 1}, ColumnPointer: []int{0, 1, 2, 3}, NzMax: 4, RealPart: []float64{1, 2, 3}}},
+		{name: "Complex", data: packSparse(FlagComplex, 3, []int32{0, 2, 1}, []int32{0, 1, 2, 3}, []float64{1, 2, 3}, []float64{4, 5, 6}),
+			content: SparsePrt{RowIndex: []int{0, 2, 1}, ColumnPointer: []int{0, 1, 2, 3}, NzMax: 3, RealPart: []float64{1, 2, 3}, ImaginaryPart: []float64{4, 5, 6}}},
+		{name: "Logical", data: packSparse(FlagLogical, 3, []int32{0, 2, 1}, []int32{0, 1, 2, 3}, []float64{1, 0, 1}, nil),
+			content: SparsePrt{RowIndex: []int{0, 2, 1}, ColumnPointer: []int{0, 1, 2, 3}, NzMax: 3, RealPart: []bool{true, false, true}}},
+		{name: "Empty", data: packSparse(0, 1, []int32{}, []int32{0, 0, 0, 0}, []float64{}, nil),
+			content: SparsePrt{ColumnPointer: []int{0, 0, 0, 0}, NzMax: 1}},
+		{name: "Uint8", data: packSparse(FlagComplex, 3, []int32{0, 2, 1}, []int32{0, 1, 2, 3}, []uint8{1, 2, 3}, []int16{-4, 5, 6}),
+			content: SparsePrt{RowIndex: []int{0, 2, 1}, ColumnPointer: []int{0, 1, 2, 3}, NzMax: 3, RealPart: []float64{1, 2, 3}, ImaginaryPart: []float64{-4, 5, 6}}},
+		{name: "Truncated", data: packSparse(0, 3, []int32{0, 2, 1}, []int32{0, 1, 2, 3}, []float64{1, 2, 3}, nil)[:100], err: true},
+		{name: "TruncatedImaginary", data: packSparse(FlagComplex, 3, []int32{0, 2, 1}, []int32{0, 1, 2, 3}, []float64{1, 2, 3}, []float64{4, 5, 6})[:150], err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := bytes.NewReader(tc.data[8:])
+			mat, _, err := extractMatrix(r, binary.LittleEndian)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if tc.err {
+				return
+			}
+			if mat.Name != "sparse" || int(mat.Class) != MxSparseClass {
+				t.Fatalf("Unexpected matrix: %#v", mat)
+			}
+			if !reflect.DeepEqual(mat.Content, tc.content) {
+				t.Fatalf("Expected: %#v\nGot: %#v", tc.content, mat.Content)
+			}
+			if r.Len() != 0 {
+				t.Fatalf("%d bytes left after extracting the sparse matrix", r.Len())
+			}
+		})
+	}
+}
+
+func TestExtract64BitIntegers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		mat  MatMatrix
+		re   interface{}
+	}{
+		{name: "Int64", mat: MatMatrix{Name: "id", Class: uint32(MxInt64Class), Dim: Dim{1, 2}, Content: NumPrt{RealPart: []int64{-1 << 40, 1<<62 + 1}}}, re: []int64{-1 << 40, 1<<62 + 1}},
+		{name: "Uint64", mat: MatMatrix{Name: "timestamp", Class: uint32(MxUint64Class), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []uint64{1<<64 - 1}}}, re: []uint64{1<<64 - 1}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := packMatrix(&buf, tc.mat, binary.LittleEndian); err != nil {
+				t.Fatal(err)
+			}
+			mat, _, err := extractMatrix(bytes.NewReader(buf.Bytes()[8:]), binary.LittleEndian)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if mat.Class != tc.mat.Class {
+				t.Fatalf("Class\tExpected: %d\tGot: %d", tc.mat.Class, mat.Class)
+			}
+			if !reflect.DeepEqual(mat.Content.(NumPrt).RealPart, tc.re) {
+				t.Fatalf("Expected: %#v\tGot: %#v", tc.re, mat.Content.(NumPrt).RealPart)
+			}
+		})
+	}
+}
+
+func TestExtractPromotedValues(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		class   int
+		flags   uint32
+		re, im  interface{}
+		content NumPrt
+		err     bool
+	}{
+		{name: "DoubleAsUint8", class: MxDoubleClass, re: []uint8{1, 255},
+			content: NumPrt{RealPart: []float64{1, 255}, DataType: MiUint8}},
+		{name: "ComplexAsInt16", class: MxDoubleClass, flags: FlagComplex, re: []uint8{2}, im: []int16{-3},
+			content: NumPrt{RealPart: []float64{2}, ImaginaryPart: []float64{-3}, DataType: MiUint8}},
+		{name: "Int32AsInt8", class: MxInt32Class, re: []int8{-1, 7},
+			content: NumPrt{RealPart: []int32{-1, 7}, DataType: MiInt8}},
+		{name: "Stored", class: MxSingleClass, re: []float32{0.5},
+			content: NumPrt{RealPart: []float32{0.5}, DataType: MiSingle}},
+		{name: "Uint8AsNegativeInt32", class: MxUint8Class, re: []int32{-1}, err: true},
+		{name: "Int16AsFraction", class: MxInt16Class, re: []float64{1.5}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var body, buf bytes.Buffer
+			order := binary.LittleEndian
+			arrayFlags := make([]byte, 8)
+			order.PutUint32(arrayFlags[:4], tc.flags|uint32(tc.class))
+			packDataElement(&body, order, MiUint32, arrayFlags)
+			packNumeric(&body, order, MiInt32, []int32{1, int32(reflect.ValueOf(tc.re).Len())})
+			packDataElement(&body, order, MiInt8, []byte("x"))
+			packNumeric(&body, order, valuesDataType(tc.re), tc.re)
+			if tc.im != nil {
+				packNumeric(&body, order, valuesDataType(tc.im), tc.im)
+			}
+			packTag(&buf, order, MiMatrix, body.Len())
+			buf.Write(body.Bytes())
+
+			mat, _, err := extractMatrix(bytes.NewReader(buf.Bytes()[8:]), order)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if tc.err {
+				return
+			}
+			if !reflect.DeepEqual(mat.Content, tc.content) {
+				t.Fatalf("Expected: %#v\nGot: %#v", tc.content, mat.Content)
+			}
+		})
+	}
+}
+
+func TestExtractObject(t *testing.T) {
+	t.Parallel()
+
+	var body, buf bytes.Buffer
+	order := binary.LittleEndian
+	arrayFlags := make([]byte, 8)
+	order.PutUint32(arrayFlags[:4], uint32(MxObjectClass))
+	packDataElement(&body, order, MiUint32, arrayFlags)
+	packNumeric(&body, order, MiInt32, []int32{1, 1})
+	packDataElement(&body, order, MiInt8, []byte("obj"))
+	packDataElement(&body, order, MiInt8, []byte("polynom"))
+	packFieldNames(&body, order, []string{"coef"})
+	packMatrix(&body, MatMatrix{Class: uint32(MxDoubleClass), Dim: Dim{1, 3}, Content: NumPrt{RealPart: []float64{1, 2, 3}}}, order)
+	packTag(&buf, order, MiMatrix, body.Len())
+	buf.Write(body.Bytes())
+
+	r := bytes.NewReader(buf.Bytes()[8:])
+	mat, _, err := extractMatrix(r, order)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if r.Len() != 0 {
+		t.Fatalf("%d bytes left after extracting the object", r.Len())
+	}
+	content, ok := mat.Content.(ObjectPrt)
+	if !ok {
+		t.Fatalf("Expected ObjectPrt, got: %#v", mat.Content)
+	}
+	if content.ClassName != "polynom" {
+		t.Fatalf("Expected class name polynom, got: %s", content.ClassName)
+	}
+	if len(content.Fields.FieldNames) != 1 || len(content.Fields.FieldValues[content.Fields.FieldNames[0]]) != 1 {
+		t.Fatalf("Unexpected fields: %#v", content.Fields)
+	}
+	coef := content.Fields.FieldValues[content.Fields.FieldNames[0]][0].(MatMatrix)
+	if !reflect.DeepEqual(coef.Content.(NumPrt).RealPart, []float64{1, 2, 3}) {
+		t.Fatalf("Unexpected value: %#v", coef)
+	}
+}
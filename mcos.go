@@ -0,0 +1,224 @@
+package matf
+
+import (
+	"fmt"
+	"math"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// maxObjectDepth limits the nesting of MCOS objects, that are decoded.
+const maxObjectDepth = 32
+
+// StringPrt represents a MATLAB string array
+type StringPrt struct {
+	Strings []string
+}
+
+// mcosDecoder converts the objects of a MCOS class into a content type. It
+// returns the dimensions of the decoded content.
+type mcosDecoder func(s *Subsystem, dims Dim, objects []McosObject, depth int) (Dim, interface{}, error)
+
+// lookupDecoder returns the decoder for a MCOS class, if it is supported
+func lookupDecoder(className string) (mcosDecoder, bool) {
+	switch className {
+	case "string":
+		return decodeString, true
+	case "table", "timetable":
+		return decodeTable, true
+	case "datetime":
+		return decodeDatetime, true
+	case "duration":
+		return decodeDuration, true
+	case "calendarDuration":
+		return decodeCalendarDuration, true
+	case "categorical":
+		return decodeCategorical, true
+	case "containers.Map":
+		return decodeContainersMap, true
+	}
+	return nil, false
+}
+
+// hasObjects returns true, if mat contains opaque objects
+func hasObjects(mat MatMatrix) bool {
+	switch content := mat.Content.(type) {
+	case OpaquePrt:
+		return true
+	case CellPrt:
+		for _, cell := range content.Cells {
+			if hasObjects(cell) {
+				return true
+			}
+		}
+	case StructPrt:
+		for _, values := range content.FieldValues {
+			for _, value := range values {
+				if element, ok := value.(MatMatrix); ok && hasObjects(element) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isReference returns true, if mat is the uint32 array, that MATLAB uses to
+// reference objects within the subsystem data.
+func isReference(mat MatMatrix) bool {
+	content, ok := mat.Content.(NumPrt)
+	if !ok || int(mat.Class) != MxUint32Class {
+		return false
+	}
+	values, err := ints(content.RealPart)
+	return err == nil && len(values) >= 6 && uint32(values[0]) == mcosReference
+}
+
+// decodeObjects replaces all MCOS objects in mat with their decoded content.
+// Objects of classes without decoder keep their OpaquePrt.
+func (s *Subsystem) decodeObjects(mat MatMatrix, depth int) (MatMatrix, error) {
+	if depth > maxObjectDepth {
+		return MatMatrix{}, fmt.Errorf("Objects are nested deeper than %d levels", maxObjectDepth)
+	}
+
+	switch content := mat.Content.(type) {
+	case OpaquePrt:
+		if content.TypeSystem != "MCOS" {
+			return mat, nil
+		}
+		return s.decodeObject(mat, content.ClassName, content.Metadata, depth)
+	case NumPrt:
+		// Objects within the subsystem data are only stored as reference
+		if !isReference(mat) {
+			return mat, nil
+		}
+		values, err := ints(content.RealPart)
+		if err != nil {
+			return MatMatrix{}, errors.Wrap(err, "\nints() in decodeObjects() failed")
+		}
+		classID := values[len(values)-1]
+		if classID <= 0 || classID >= len(s.Classes) {
+			return MatMatrix{}, fmt.Errorf("Invalid class ID in object reference: %d", classID)
+		}
+		return s.decodeObject(mat, s.Classes[classID].String(), mat, depth)
+	case CellPrt:
+		var cells []MatMatrix
+		for _, cell := range content.Cells {
+			decoded, err := s.decodeObjects(cell, depth+1)
+			if err != nil {
+				return MatMatrix{}, err
+			}
+			cells = append(cells, decoded)
+		}
+		mat.Content = CellPrt{Cells: cells}
+	case StructPrt:
+		values := make(map[string][]interface{})
+		for name, fieldValues := range content.FieldValues {
+			for _, value := range fieldValues {
+				if element, ok := value.(MatMatrix); ok {
+					decoded, err := s.decodeObjects(element, depth+1)
+					if err != nil {
+						return MatMatrix{}, err
+					}
+					value = decoded
+				}
+				values[name] = append(values[name], value)
+			}
+		}
+		mat.Content = StructPrt{FieldNames: content.FieldNames, FieldValues: values}
+	}
+	return mat, nil
+}
+
+func (s *Subsystem) decodeObject(mat MatMatrix, className string, metadata MatMatrix, depth int) (MatMatrix, error) {
+	decoder, ok := lookupDecoder(className)
+	if !ok {
+		return mat, nil
+	}
+	dims, objects, err := s.Resolve(metadata)
+	if err != nil {
+		return MatMatrix{}, errors.Wrap(err, fmt.Sprintf("\nResolve() for class %s failed", className))
+	}
+	dims, content, err := decoder(s, dims, objects, depth+1)
+	if err != nil {
+		return MatMatrix{}, errors.Wrap(err, fmt.Sprintf("\ndecoder for class %s failed", className))
+	}
+	mat.Class = uint32(MxOpaqueClass)
+	mat.Dim = dims
+	mat.Content = content
+	return mat, nil
+}
+
+// property returns the decoded value of a property of an object
+func (s *Subsystem) property(object McosObject, name string, depth int) (MatMatrix, error) {
+	value, ok := object.Properties[name]
+	if !ok {
+		return MatMatrix{}, fmt.Errorf("Object of class %s has no property %s", object.Class, name)
+	}
+	return s.decodeObjects(value, depth)
+}
+
+// decodeString decodes the property any of a string object. It contains a
+// version, the dimensions and the length of each string, followed by the
+// UTF-16 code units of all strings, where each uint64 holds four of them.
+func decodeString(s *Subsystem, dims Dim, objects []McosObject, depth int) (Dim, interface{}, error) {
+	var content StringPrt
+
+	if len(objects) != 1 {
+		return nil, nil, fmt.Errorf("Expected a single string object, got %d", len(objects))
+	}
+	encoded, err := s.property(objects[0], "any", depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := encoded.uint64s()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(values) < 2 || values[0] != 1 {
+		return nil, nil, fmt.Errorf("Unsupported encoding of string")
+	}
+	// Sizes are compared as uint64, before they are converted to int
+	remaining := uint64(len(values) - 2)
+	if values[1] > remaining {
+		return nil, nil, fmt.Errorf("Invalid number of dimensions of string: %d", values[1])
+	}
+	numberOfDims := int(values[1])
+	remaining -= values[1]
+	dims = Dim{}
+	empty := numberOfDims == 0
+	for _, v := range values[2 : 2+numberOfDims] {
+		if v > math.MaxInt32 {
+			return nil, nil, fmt.Errorf("Invalid dimension of string: %d", v)
+		}
+		dims = append(dims, int(v))
+		empty = empty || v == 0
+	}
+	var numberOfStrings uint64
+	if !empty {
+		numberOfStrings = 1
+		for _, v := range values[2 : 2+numberOfDims] {
+			if v > remaining/numberOfStrings {
+				return nil, nil, fmt.Errorf("Invalid number of strings for dimensions %v", dims)
+			}
+			numberOfStrings *= v
+		}
+	}
+	lengths := values[2+numberOfDims : 2+numberOfDims+int(numberOfStrings)]
+
+	var units []uint16
+	for _, v := range values[2+numberOfDims+int(numberOfStrings):] {
+		units = append(units, uint16(v), uint16(v>>16), uint16(v>>32), uint16(v>>48))
+	}
+	for _, length := range lengths {
+		// Missing strings do not contain characters
+		if length > uint64(len(units)) {
+			content.Strings = append(content.Strings, "")
+			continue
+		}
+		content.Strings = append(content.Strings, string(utf16.Decode(units[:length])))
+		units = units[length:]
+	}
+	return dims, content, nil
+}
@@ -0,0 +1,114 @@
+package matf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// packStrings encodes strings like the property any of a MATLAB string.
+func packStrings(dims []uint64, strs ...string) MatMatrix {
+	var units []uint16
+	values := []uint64{1, uint64(len(dims))}
+	values = append(values, dims...)
+	for _, str := range strs {
+		encoded := utf16.Encode([]rune(str))
+		values = append(values, uint64(len(encoded)))
+		units = append(units, encoded...)
+	}
+	for i := 0; i < len(units); i += 4 {
+		var v uint64
+		for j := 0; j < 4 && i+j < len(units); j++ {
+			v |= uint64(units[i+j]) << (16 * uint(j))
+		}
+		values = append(values, v)
+	}
+	return MatMatrix{Class: uint32(MxUint64Class), Dim: Dim{1, len(values)}, Content: NumPrt{RealPart: values}}
+}
+
+func readMcosFile(t *testing.T, elements []MatMatrix, fixture mcosFixture) []MatMatrix {
+	tdir, ferr := ioutil.TempDir("", "TestMcos")
+	if ferr != nil {
+		t.Fatal(ferr)
+	}
+	defer os.RemoveAll(tdir)
+
+	name := filepath.Join(tdir, "mcos.mat")
+	writeMcosFile(t, name, elements, fixture)
+	m, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(m)
+
+	var decoded []MatMatrix
+	for range elements {
+		element, err := ReadDataElement(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, element)
+	}
+	return decoded
+}
+
+func TestDecodeString(t *testing.T) {
+	fixture := mcosFixture{
+		names:   []string{"any", "string"},
+		classes: [][2]uint32{{0, 2}},
+		objects: [][]uint32{
+			{1, 1, 1, 0},
+			{1, 1, 1, 1},
+		},
+		cells: []MatMatrix{
+			packStrings([]uint64{2, 2}, "a", "Grüße", "", "😀"),
+			packStrings([]uint64{1, 1}, "nested"),
+		},
+	}
+	elements := readMcosFile(t, []MatMatrix{
+		{Name: "s", Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "string", Metadata: mcosRef(1, []uint32{1, 1}, 1)}},
+		{Name: "c", Class: uint32(MxCellClass), Dim: Dim{1, 1}, Content: CellPrt{Cells: []MatMatrix{
+			{Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "string", Metadata: mcosRef(1, []uint32{1, 1}, 2)}},
+		}}},
+	}, fixture)
+
+	if !reflect.DeepEqual(elements[0].Dim, Dim{2, 2}) {
+		t.Fatalf("Expected dims [2 2], got: %v", elements[0].Dim)
+	}
+	expected := StringPrt{Strings: []string{"a", "Grüße", "", "😀"}}
+	if !reflect.DeepEqual(elements[0].Content, expected) {
+		t.Fatalf("Expected: %#v\tGot: %#v", expected, elements[0].Content)
+	}
+	nested := elements[1].Content.(CellPrt).Cells[0]
+	if !reflect.DeepEqual(nested.Content, StringPrt{Strings: []string{"nested"}}) {
+		t.Fatalf("Unexpected nested string: %#v", nested)
+	}
+}
+
+func TestDecodeStringErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		object McosObject
+	}{
+		{name: "NoProperty", object: McosObject{Properties: map[string]MatMatrix{}}},
+		{name: "Version", object: McosObject{Properties: map[string]MatMatrix{"any": {Class: uint32(MxUint64Class), Content: NumPrt{RealPart: []uint64{2, 2, 1, 1, 0}}}}}},
+		{name: "Dims", object: McosObject{Properties: map[string]MatMatrix{"any": {Class: uint32(MxUint64Class), Content: NumPrt{RealPart: []uint64{1, 4, 1}}}}}},
+		{name: "Strings", object: McosObject{Properties: map[string]MatMatrix{"any": {Class: uint32(MxUint64Class), Content: NumPrt{RealPart: []uint64{1, 2, 2, 1, 0}}}}}},
+		{name: "HugeDims", object: McosObject{Properties: map[string]MatMatrix{"any": {Class: uint32(MxUint64Class), Content: NumPrt{RealPart: []uint64{1, 1<<64 - 1, 1}}}}}},
+		{name: "HugeDim", object: McosObject{Properties: map[string]MatMatrix{"any": {Class: uint32(MxUint64Class), Content: NumPrt{RealPart: []uint64{1, 2, 1<<64 - 1, 0}}}}}},
+		{name: "OverflowStrings", object: McosObject{Properties: map[string]MatMatrix{"any": {Class: uint32(MxUint64Class), Content: NumPrt{RealPart: []uint64{1, 3, 1 << 31, 1 << 31, 1 << 31, 0}}}}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := decodeString(&Subsystem{}, nil, []McosObject{tc.object}, 0); err == nil {
+				t.Fatalf("Expected error, got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package matf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// mcosReference marks the metadata of an opaque object as reference to
+// objects in the subsystem data.
+const mcosReference = 0xDD000000
+
+// McosClass describes a class of the MATLAB Class Object System (MCOS)
+type McosClass struct {
+	Namespace string
+	Name      string
+}
+
+// McosObject represents a single object of the MATLAB Class Object System
+// (MCOS), that is stored in the subsystem data.
+type McosObject struct {
+	Class      McosClass
+	Properties map[string]MatMatrix
+}
+
+// Subsystem contains the parsed subsystem data of a MAT-file. MATLAB stores
+// the state of all MCOS objects, like string, datetime or table, in there.
+type Subsystem struct {
+	Version uint32       // Version of the MCOS metadata.
+	Names   []string     // Names of all classes and properties.
+	Classes []McosClass  // Indexed by class ID, the first entry is unused.
+	Objects []McosObject // Indexed by object ID, the first entry is unused.
+}
+
+// String returns the fully qualified name of the class
+func (c McosClass) String() string {
+	if len(c.Namespace) == 0 {
+		return c.Name
+	}
+	return c.Namespace + "." + c.Name
+}
+
+func readSubsystemOffset(data []byte, order binary.ByteOrder) int64 {
+	if len(data) != 8 {
+		return 0
+	}
+	// Files without subsystem data use either zeros or spaces
+	if bytes.Equal(data, make([]byte, 8)) || bytes.Equal(data, bytes.Repeat([]byte{0x20}, 8)) {
+		return 0
+	}
+	return int64(order.Uint64(data))
+}
+
+// readUint8s returns the real part of an uint8 array as bytes
+func readUint8s(mat MatMatrix) ([]byte, error) {
+	content, ok := mat.Content.(NumPrt)
+	if !ok || int(mat.Class) != MxUint8Class {
+		return nil, fmt.Errorf("Expected uint8 array, got class %d", mat.Class)
+	}
+	values, err := uint64s(content.RealPart)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	for i, v := range values {
+		if v > math.MaxUint8 {
+			return nil, fmt.Errorf("Value %d at %d exceeds the range of uint8", v, i)
+		}
+		data = append(data, byte(v))
+	}
+	return data, nil
+}
+
+// lookupField returns the values of a struct field, ignoring the padding of
+// the field names.
+func lookupField(content StructPrt, field string) ([]interface{}, bool) {
+	for _, name := range content.FieldNames {
+		if strings.TrimRight(name, "\x00") == field {
+			return content.FieldValues[name], true
+		}
+	}
+	return nil, false
+}
+
+func parseSubsystem(data []byte) (*Subsystem, error) {
+	var order binary.ByteOrder = binary.BigEndian
+
+	// The subsystem data starts with a version and endian indicator
+	if len(data) < 8 {
+		return nil, fmt.Errorf("Subsystem data too short: %d bytes", len(data))
+	}
+	if bytes.Equal(data[2:4], []byte{0x49, 0x4d}) {
+		order = binary.LittleEndian
+	}
+	r := bytes.NewReader(data[8:])
+	dataType, numberOfBytes, _, err := extractTag(r, order)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nextractTag() in parseSubsystem() failed")
+	}
+	if int(dataType) != MiMatrix {
+		return nil, fmt.Errorf("Unexpected data type %d in subsystem data", dataType)
+	}
+	element, _, err := extractDataElement(r, order, int(dataType), int(numberOfBytes))
+	if err != nil {
+		return nil, errors.Wrap(err, "\nextractDataElement() in parseSubsystem() failed")
+	}
+
+	content, ok := element.(MatMatrix).Content.(StructPrt)
+	if !ok {
+		return nil, fmt.Errorf("Subsystem data does not contain a struct")
+	}
+	values, ok := lookupField(content, "MCOS")
+	if !ok || len(values) != 1 {
+		// No MCOS objects stored
+		return &Subsystem{}, nil
+	}
+	mcos, ok := values[0].(MatMatrix).Content.(OpaquePrt)
+	if !ok || mcos.ClassName != "FileWrapper__" {
+		return nil, fmt.Errorf("Unexpected MCOS content in subsystem data")
+	}
+	cells, ok := mcos.Metadata.Content.(CellPrt)
+	if !ok || len(cells.Cells) < 2 {
+		return nil, fmt.Errorf("Unexpected MCOS metadata in subsystem data")
+	}
+	metadata, err := readUint8s(cells.Cells[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "\nreadUint8s() in parseSubsystem() failed")
+	}
+
+	return parseMcosMetadata(metadata, order, cells.Cells)
+}
+
+// parseMcosMetadata parses the first cell of the FileWrapper__ object. It
+// starts with the version, the number of names and the offsets of the
+// following regions:
+//
+//	0: class IDs		4 uint32 per class
+//	1: properties of objects with saveobj()
+//	2: object IDs		6 uint32 per object
+//	3: properties of objects
+//
+// The other regions are not used by this package.
+func parseMcosMetadata(data []byte, order binary.ByteOrder, cells []MatMatrix) (*Subsystem, error) {
+	var s Subsystem
+	var offsets [8]int
+
+	if len(data) < 40 {
+		return nil, fmt.Errorf("MCOS metadata too short: %d bytes", len(data))
+	}
+	s.Version = order.Uint32(data[0:4])
+	numberOfNames := int(order.Uint32(data[4:8]))
+	last := 40
+	for i := range offsets {
+		offsets[i] = int(order.Uint32(data[8+4*i : 12+4*i]))
+		if offsets[i] < last || offsets[i] > len(data) {
+			return nil, fmt.Errorf("Invalid offset of MCOS metadata region %d: %d", i, offsets[i])
+		}
+		last = offsets[i]
+	}
+
+	// Names
+	for _, name := range strings.Split(string(data[40:offsets[0]]), "\x00") {
+		if len(s.Names) == numberOfNames {
+			break
+		}
+		if len(name) != 0 {
+			s.Names = append(s.Names, name)
+		}
+	}
+	name := func(i int) (string, error) {
+		if i == 0 {
+			return "", nil
+		}
+		if i > len(s.Names) {
+			return "", fmt.Errorf("Invalid name index: %d", i)
+		}
+		return s.Names[i-1], nil
+	}
+
+	// Class IDs
+	for i := offsets[0]; i+16 <= offsets[1]; i += 16 {
+		namespace, err := name(int(order.Uint32(data[i : i+4])))
+		if err != nil {
+			return nil, err
+		}
+		class, err := name(int(order.Uint32(data[i+4 : i+8])))
+		if err != nil {
+			return nil, err
+		}
+		s.Classes = append(s.Classes, McosClass{Namespace: namespace, Name: class})
+	}
+
+	saveobjProperties := readPropertyBlocks(data[offsets[1]:offsets[2]], order)
+	objProperties := readPropertyBlocks(data[offsets[3]:offsets[4]], order)
+
+	// Object IDs
+	for i := offsets[2]; i+24 <= offsets[3]; i += 24 {
+		var object McosObject
+		classID := int(order.Uint32(data[i : i+4]))
+		saveobjID := int(order.Uint32(data[i+12 : i+16]))
+		objID := int(order.Uint32(data[i+16 : i+20]))
+		if len(s.Objects) == 0 {
+			// The first entry does not describe an object
+			s.Objects = append(s.Objects, object)
+			continue
+		}
+		if classID >= len(s.Classes) {
+			return nil, fmt.Errorf("Invalid class ID %d for object %d", classID, len(s.Objects))
+		}
+		object.Class = s.Classes[classID]
+
+		blocks, id := objProperties, objID
+		if saveobjID != 0 {
+			blocks, id = saveobjProperties, saveobjID
+		}
+		if id >= len(blocks) {
+			return nil, fmt.Errorf("Invalid property ID %d for object %d", id, len(s.Objects))
+		}
+		object.Properties = make(map[string]MatMatrix)
+		for _, property := range blocks[id] {
+			propertyName, err := name(int(property[0]))
+			if err != nil {
+				return nil, err
+			}
+			value, err := readPropertyValue(property, cells, name)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("\nreadPropertyValue() for %s.%s failed", object.Class, propertyName))
+			}
+			object.Properties[propertyName] = value
+		}
+		s.Objects = append(s.Objects, object)
+	}
+
+	return &s, nil
+}
+
+// readPropertyBlocks splits a region of properties into its blocks. Each block
+// starts with the number of properties, followed by three uint32 for each
+// property and is aligned to 8 bytes.
+func readPropertyBlocks(data []byte, order binary.ByteOrder) [][][3]uint32 {
+	var blocks [][][3]uint32
+	for i := 0; i+4 <= len(data); {
+		var block [][3]uint32
+		numberOfProperties := int(order.Uint32(data[i : i+4]))
+		i += 4
+		for ; numberOfProperties > 0 && i+12 <= len(data); numberOfProperties-- {
+			block = append(block, [3]uint32{order.Uint32(data[i : i+4]), order.Uint32(data[i+4 : i+8]), order.Uint32(data[i+8 : i+12])})
+			i += 12
+		}
+		if i%8 != 0 {
+			i += 8 - i%8
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// readPropertyValue returns the value of a property, which consists of the
+// name index, the type and the value itself.
+func readPropertyValue(property [3]uint32, cells []MatMatrix, name func(int) (string, error)) (MatMatrix, error) {
+	switch property[1] {
+	case 0:
+		// Value is the index of a name
+		value, err := name(int(property[2]))
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		return MatMatrix{Class: uint32(MxCharClass), Dim: Dim{1, len(value)}, Content: CharPrt{Chars: []string{value}}}, nil
+	case 1:
+		// Value is the index of a cell of the FileWrapper__ object, which
+		// starts after the metadata and an unused cell.
+		i := int(property[2]) + 2
+		if i >= len(cells) {
+			return MatMatrix{}, fmt.Errorf("Invalid cell index: %d", i)
+		}
+		return cells[i], nil
+	case 2:
+		// Value is a logical scalar
+		return MatMatrix{Class: uint32(MxUint8Class), Flags: FlagLogical, Dim: Dim{1, 1}, Content: NumPrt{RealPart: []uint8{uint8(property[2])}}}, nil
+	}
+	return MatMatrix{}, fmt.Errorf("Unknown type of property value: %d", property[1])
+}
+
+// Resolve returns the dimensions and objects, which are referenced by the
+// metadata of an opaque MCOS object.
+func (s *Subsystem) Resolve(metadata MatMatrix) (Dim, []McosObject, error) {
+	content, ok := metadata.Content.(NumPrt)
+	if !ok || int(metadata.Class) != MxUint32Class {
+		return nil, nil, fmt.Errorf("Metadata of class %d is no object reference", metadata.Class)
+	}
+	values, err := ints(content.RealPart)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "\nints() in Resolve() failed")
+	}
+	if len(values) < 3 || uint32(values[0]) != mcosReference {
+		return nil, nil, fmt.Errorf("Metadata is no object reference")
+	}
+	numberOfDims := values[1]
+	if numberOfDims < 0 || len(values) < 2+numberOfDims {
+		return nil, nil, fmt.Errorf("Invalid number of dimensions in object reference: %d", numberOfDims)
+	}
+	dims := Dim(values[2 : 2+numberOfDims])
+	ids := values[2+numberOfDims:]
+	if len(ids) < dims.NumElements() {
+		return nil, nil, fmt.Errorf("Object reference contains %d of %d objects", len(ids), dims.NumElements())
+	}
+
+	var objects []McosObject
+	for _, id := range ids[:dims.NumElements()] {
+		if id <= 0 || id >= len(s.Objects) {
+			return nil, nil, fmt.Errorf("Invalid object ID: %d", id)
+		}
+		objects = append(objects, s.Objects[id])
+	}
+	return dims, objects, nil
+}
+
+// Subsystem returns the parsed subsystem data of the MAT-file. It returns
+// nil, if the MAT-file does not contain subsystem data.
+func (m *Matf) Subsystem() (*Subsystem, error) {
+	if m.subsystem == nil && m.v73 != nil {
+		subsystem, err := m.v73.readSubsystem()
+		if err != nil {
+			return nil, errors.Wrap(err, "\nreadSubsystem() in Subsystem() failed")
+		}
+		m.subsystem = subsystem
+	}
+	if m.subsystem != nil || m.subsystemOffset == 0 {
+		return m.subsystem, nil
+	}
+	order := m.order()
+
+	tag := make([]byte, 8)
+	if _, err := m.file.ReadAt(tag, m.subsystemOffset); err != nil {
+		return nil, errors.Wrap(err, "\nfile.ReadAt() in Subsystem() failed")
+	}
+	dataType := order.Uint32(tag[:4])
+	completeBytes := order.Uint32(tag[4:8])
+	data := io.NewSectionReader(m.file, m.subsystemOffset+8, int64(completeBytes))
+	mat, err := parseDataElementField(order, dataType, completeBytes, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nparseDataElementField() in Subsystem() failed")
+	}
+	raw, err := readUint8s(mat)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nreadUint8s() in Subsystem() failed")
+	}
+	subsystem, err := parseSubsystem(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nparseSubsystem() in Subsystem() failed")
+	}
+	m.subsystem = subsystem
+	return subsystem, nil
+}
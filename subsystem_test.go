@@ -0,0 +1,373 @@
+package matf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// mcosFixture describes the content of the subsystem data for tests.
+type mcosFixture struct {
+	names   []string
+	classes [][2]uint32 // Namespace and class name index
+	objects [][]uint32  // Class ID followed by the property triples
+	cells   []MatMatrix // Property values with type 1
+}
+
+func packUint32s(order binary.ByteOrder, values ...uint32) []byte {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		order.PutUint32(data[4*i:], v)
+	}
+	return data
+}
+
+func packMcosMetadata(order binary.ByteOrder, fixture mcosFixture) []byte {
+	var names, classes, saveobj, objects, properties bytes.Buffer
+
+	for _, name := range fixture.names {
+		names.WriteString(name + "\x00")
+	}
+	packPadding(&names, names.Len())
+
+	classes.Write(make([]byte, 16))
+	for _, class := range fixture.classes {
+		classes.Write(packUint32s(order, class[0], class[1], 0, 0))
+	}
+
+	saveobj.Write(make([]byte, 8))
+	objects.Write(make([]byte, 24))
+	properties.Write(make([]byte, 8))
+	for i, object := range fixture.objects {
+		objects.Write(packUint32s(order, object[0], 0, 0, 0, uint32(i+1), uint32(i+1)))
+		properties.Write(packUint32s(order, uint32(len(object[1:])/3)))
+		properties.Write(packUint32s(order, object[1:]...))
+		packPadding(&properties, 4+4*len(object[1:]))
+	}
+
+	offset := uint32(40 + names.Len())
+	var offsets []uint32
+	for _, region := range []*bytes.Buffer{&classes, &saveobj, &objects, &properties} {
+		offsets = append(offsets, offset)
+		offset += uint32(region.Len())
+	}
+	for len(offsets) < 8 {
+		offsets = append(offsets, offset)
+	}
+
+	var data bytes.Buffer
+	data.Write(packUint32s(order, 4, uint32(len(fixture.names))))
+	data.Write(packUint32s(order, offsets...))
+	for _, region := range []*bytes.Buffer{&names, &classes, &saveobj, &objects, &properties} {
+		data.Write(region.Bytes())
+	}
+	return data.Bytes()
+}
+
+// mcosCells returns the cells of the FileWrapper__ object: the metadata, an
+// unused empty array, the property values and an empty cell array.
+func mcosCells(order binary.ByteOrder, fixture mcosFixture) []MatMatrix {
+	metadata := packMcosMetadata(order, fixture)
+	cells := []MatMatrix{
+		{Class: uint32(MxUint8Class), Dim: Dim{len(metadata), 1}, Content: NumPrt{RealPart: metadata}},
+		{Class: uint32(MxDoubleClass), Content: NumPrt{}},
+	}
+	cells = append(cells, fixture.cells...)
+	return append(cells, MatMatrix{Class: uint32(MxCellClass), Dim: Dim{0, 0}, Content: CellPrt{}})
+}
+
+func packSubsystem(t *testing.T, order binary.ByteOrder, fixture mcosFixture) []byte {
+	cells := mcosCells(order, fixture)
+	wrapper := MatMatrix{Class: uint32(MxOpaqueClass), Content: OpaquePrt{
+		TypeSystem: "MCOS",
+		ClassName:  "FileWrapper__",
+		Metadata:   MatMatrix{Class: uint32(MxCellClass), Dim: Dim{len(cells), 1}, Content: CellPrt{Cells: cells}},
+	}}
+	subsystem := MatMatrix{Class: uint32(MxStructClass), Dim: Dim{1, 1}, Content: StructPrt{
+		FieldNames:  []string{"MCOS"},
+		FieldValues: map[string][]interface{}{"MCOS": {wrapper}},
+	}}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0x00, 0x01, 0x49, 0x4d, 0x00, 0x00, 0x00, 0x00})
+	if err := packMatrix(&buf, subsystem, order); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// mcosRef returns the metadata of an opaque object, which references objects
+// in the subsystem data.
+func mcosRef(classID uint32, dims []uint32, ids ...uint32) MatMatrix {
+	values := []uint32{mcosReference, uint32(len(dims))}
+	values = append(values, dims...)
+	values = append(values, ids...)
+	values = append(values, classID)
+	return MatMatrix{Class: uint32(MxUint32Class), Dim: Dim{len(values), 1}, Content: NumPrt{RealPart: values}}
+}
+
+// writeMcosFile writes elements followed by the subsystem data into a new
+// MAT-file.
+func writeMcosFile(t *testing.T, name string, elements []MatMatrix, fixture mcosFixture) {
+	w, err := Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, element := range elements {
+		if err := w.WriteDataElement(element); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offset, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsystem := packSubsystem(t, w.order, fixture)
+	var buf bytes.Buffer
+	if err := packMatrix(&buf, MatMatrix{Class: uint32(MxUint8Class), Dim: Dim{1, len(subsystem)}, Content: NumPrt{RealPart: subsystem}}, w.order); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, 8)
+	w.order.PutUint64(header, uint64(offset))
+	if _, err := w.file.WriteAt(header, 116); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeV73McosFile writes elements into a new MAT-file in version 7.3. The
+// metadata of opaque elements is stored as dataset with the attribute
+// MATLAB_object_decode, the cells of the subsystem data in #subsystem#/MCOS.
+func writeV73McosFile(t *testing.T, name string, elements []MatMatrix, fixture mcosFixture) {
+	w, err := CreateV73(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objectDecode := encodeAttribute("MATLAB_object_decode", newHDF5Type(hdf5FixedPoint, 4, true), nil, packUint32s(binary.LittleEndian, 3))
+	for _, element := range elements {
+		content, ok := element.Content.(OpaquePrt)
+		if !ok {
+			if err := w.WriteDataElement(element); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		data, err := packValues(binary.LittleEndian, MiUint32, content.Metadata.Content.(NumPrt).RealPart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		address, err := w.v73.h.writeDataset(v73Types[MxUint32Class], hdf5Dims(content.Metadata.Dim), data, zlib.NoCompression, [][]byte{v73Class(content.ClassName), objectDecode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.v73.variables = append(w.v73.variables, hdf5Link{name: element.Name, address: address})
+	}
+
+	cells := mcosCells(binary.LittleEndian, fixture)
+	refs, err := w.v73.writeRefs(cells, zlib.NoCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mcos, err := w.v73.h.writeDataset(v73Reference, hdf5Dims([]int{len(cells), 1}), refs, zlib.NoCompression, [][]byte{v73Class("FileWrapper__"), objectDecode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsystem, _, _, err := w.v73.h.writeGroup([]hdf5Link{{name: "MCOS", address: mcos}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.v73.variables = append(w.v73.variables, hdf5Link{name: "#subsystem#", address: subsystem})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubsystemV73(t *testing.T) {
+	tdir, ferr := ioutil.TempDir("", "TestSubsystemV73")
+	if ferr != nil {
+		t.Fatal(ferr)
+	}
+	defer os.RemoveAll(tdir)
+
+	fixture := mcosFixture{
+		names:   []string{"any", "string"},
+		classes: [][2]uint32{{0, 2}},
+		objects: [][]uint32{{1, 1, 1, 0}},
+		cells:   []MatMatrix{packStrings([]uint64{1, 2}, "a", "b")},
+	}
+	name := filepath.Join(tdir, "subsystem.mat")
+	writeV73McosFile(t, name, []MatMatrix{
+		{Name: "s", Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "string", Metadata: mcosRef(1, []uint32{1, 1}, 1)}},
+		{Name: "plain", Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{1}}},
+	}, fixture)
+
+	m, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(m)
+
+	s, err := m.Subsystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s == nil || !reflect.DeepEqual(s.Names, fixture.names) {
+		t.Fatalf("Unexpected subsystem: %#v", s)
+	}
+
+	// Variables of HDF5 based MAT-files are ordered by name
+	element, err := ReadDataElement(m)
+	if err != nil || element.Name != "plain" {
+		t.Fatalf("Expected variable plain, got: %#v %v", element, err)
+	}
+	expected := StringPrt{Strings: []string{"a", "b"}}
+	if element, err = ReadDataElement(m); err != nil {
+		t.Fatal(err)
+	}
+	if element.Name != "s" || !reflect.DeepEqual(element.Dim, Dim{1, 2}) || !reflect.DeepEqual(element.Content, expected) {
+		t.Fatalf("Unexpected string: %#v", element)
+	}
+	if element, err = m.Get("s"); err != nil || !reflect.DeepEqual(element.Content, expected) {
+		t.Fatalf("Unexpected string from Get(): %#v %v", element, err)
+	}
+	mats, err := m.Load()
+	if err != nil || len(mats) != 2 || !reflect.DeepEqual(mats["s"].Content, expected) {
+		t.Fatalf("Unexpected variables from Load(): %#v %v", mats, err)
+	}
+
+	// The subsystem data itself is no variable
+	if _, err = ReadDataElement(m); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got: %v", err)
+	}
+}
+
+func TestSubsystem(t *testing.T) {
+	tdir, ferr := ioutil.TempDir("", "TestSubsystem")
+	if ferr != nil {
+		t.Fatal(ferr)
+	}
+	defer os.RemoveAll(tdir)
+
+	fixture := mcosFixture{
+		names:   []string{"Value", "Enabled", "Unit", "meter", "pkg", "Length"},
+		classes: [][2]uint32{{5, 6}},
+		objects: [][]uint32{
+			{1, 1, 1, 0, 2, 2, 1, 3, 0, 4},
+			{1, 1, 1, 1, 2, 2, 0, 3, 0, 4},
+		},
+		cells: []MatMatrix{
+			{Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{42}}},
+			{Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{23}}},
+		},
+	}
+	name := filepath.Join(tdir, "subsystem.mat")
+	writeMcosFile(t, name, []MatMatrix{
+		{Name: "len", Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "Length", Metadata: mcosRef(1, []uint32{1, 2}, 1, 2)}},
+		{Name: "plain", Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{1}}},
+	}, fixture)
+
+	m, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(m)
+
+	s, err := m.Subsystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version != 4 || !reflect.DeepEqual(s.Names, fixture.names) {
+		t.Fatalf("Unexpected version %d or names %v", s.Version, s.Names)
+	}
+	if len(s.Classes) != 2 || s.Classes[1].String() != "pkg.Length" {
+		t.Fatalf("Unexpected classes: %#v", s.Classes)
+	}
+
+	element, err := ReadDataElement(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, ok := element.Content.(OpaquePrt)
+	if !ok || content.TypeSystem != "MCOS" || content.ClassName != "Length" {
+		t.Fatalf("Unexpected opaque object: %#v", element)
+	}
+	dims, objects, err := s.Resolve(content.Metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dims, Dim{1, 2}) || len(objects) != 2 {
+		t.Fatalf("Unexpected objects: %v %#v", dims, objects)
+	}
+	for i, expected := range []float64{42, 23} {
+		value := objects[i].Properties["Value"].Content.(NumPrt).RealPart
+		if !reflect.DeepEqual(value, []float64{expected}) {
+			t.Fatalf("Value\tExpected: %v\tGot: %#v", expected, value)
+		}
+		enabled := objects[i].Properties["Enabled"].Content.(NumPrt).RealPart
+		if !reflect.DeepEqual(enabled, []uint8{uint8(1 - i)}) {
+			t.Fatalf("Enabled\tExpected: %v\tGot: %#v", 1-i, enabled)
+		}
+		unit := objects[i].Properties["Unit"].Content.(CharPrt).Chars
+		if !reflect.DeepEqual(unit, []string{"meter"}) {
+			t.Fatalf("Unit\tExpected: meter\tGot: %#v", unit)
+		}
+	}
+
+	// The subsystem data itself is no variable
+	element, err = ReadDataElement(m)
+	if err != nil || element.Name != "plain" {
+		t.Fatalf("Expected variable plain, got: %#v %v", element, err)
+	}
+	if _, err = ReadDataElement(m); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got: %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	s := &Subsystem{Objects: []McosObject{{}, {Class: McosClass{Name: "a"}}}}
+
+	tests := []struct {
+		name     string
+		metadata MatMatrix
+		err      string
+	}{
+		{name: "Valid", metadata: mcosRef(1, []uint32{1, 1}, 1)},
+		{name: "NoReference", metadata: MatMatrix{Class: uint32(MxUint32Class), Content: NumPrt{RealPart: []uint32{1, 2, 1, 1, 1, 1}}}, err: "no object reference"},
+		{name: "WrongClass", metadata: MatMatrix{Class: uint32(MxDoubleClass), Content: NumPrt{}}, err: "no object reference"},
+		{name: "MissingObjects", metadata: mcosRef(1, []uint32{2, 2}, 1), err: "contains 2 of 4 objects"},
+		{name: "InvalidObject", metadata: mcosRef(1, []uint32{1, 1}, 2), err: "Invalid object ID"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, objects, err := s.Resolve(tc.metadata)
+			if err != nil {
+				if matched, _ := regexp.MatchString(tc.err, err.Error()); !matched {
+					t.Fatalf("Error matching regex: %v \t Got: %v", tc.err, err)
+				} else {
+					return
+				}
+				t.Fatalf("Expected no error, got: %v", err)
+			} else if len(tc.err) != 0 {
+				t.Fatalf("Expected error, got none")
+			}
+			if len(objects) != 1 || objects[0].Class.Name != "a" {
+				t.Fatalf("Unexpected objects: %#v", objects)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package matf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table represents a MATLAB table or timetable
+type Table struct {
+	VariableNames  []string
+	DimensionNames []string
+	RowNames       []string    // Names of the rows of a table, empty if there are none.
+	RowTimes       MatMatrix   // Time of each row of a timetable.
+	Columns        []MatMatrix // Content of each variable.
+}
+
+// readCellStrings returns the content of a cell array of character vectors
+func readCellStrings(mat MatMatrix) ([]string, error) {
+	var strs []string
+	switch content := mat.Content.(type) {
+	case CellPrt:
+		for _, cell := range content.Cells {
+			chars, ok := cell.Content.(CharPrt)
+			if !ok {
+				return nil, fmt.Errorf("Expected char array in cell, got %T", cell.Content)
+			}
+			strs = append(strs, strings.Join(chars.Chars, ""))
+		}
+	case CharPrt:
+		strs = append(strs, content.Chars...)
+	case StringPrt:
+		strs = append(strs, content.Strings...)
+	case NumPrt:
+		// Empty arrays are stored as double
+		if mat.NumElements() != 0 {
+			return nil, fmt.Errorf("Expected cell array of char arrays, got numeric array")
+		}
+	default:
+		return nil, fmt.Errorf("Expected cell array of char arrays, got %T", mat.Content)
+	}
+	return strs, nil
+}
+
+// readScalar returns the real value of a numeric scalar
+func readScalar(mat MatMatrix) (float64, error) {
+	values, err := mat.Float64s()
+	if err != nil {
+		return 0, err
+	}
+	if len(values) != 1 {
+		return 0, fmt.Errorf("Expected numeric scalar, got %d elements", len(values))
+	}
+	return values[0], nil
+}
+
+// decodeTable decodes table and timetable objects. Both store their
+// variables in a cell array, but use different names for their properties.
+func decodeTable(s *Subsystem, dims Dim, objects []McosObject, depth int) (Dim, interface{}, error) {
+	var content Table
+	var names map[string]string
+
+	if len(objects) != 1 {
+		return nil, nil, fmt.Errorf("Expected a single table object, got %d", len(objects))
+	}
+	object := objects[0]
+
+	switch object.Class.String() {
+	case "table":
+		names = map[string]string{"data": "data", "rows": "nrows", "vars": "nvars", "varNames": "varnames", "dimNames": "dimnames"}
+	case "timetable":
+		names = map[string]string{"data": "data", "rows": "numRows", "vars": "numVars", "varNames": "varNames", "dimNames": "dimNames"}
+	default:
+		return nil, nil, fmt.Errorf("Class %s is not a table", object.Class)
+	}
+
+	data, err := s.property(object, names["data"], depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, ok := data.Content.(CellPrt)
+	if !ok {
+		return nil, nil, fmt.Errorf("Expected cell array of variables, got %T", data.Content)
+	}
+	content.Columns = columns.Cells
+
+	rows, err := s.property(object, names["rows"], depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	numberOfRows, err := readScalar(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	vars, err := s.property(object, names["vars"], depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	numberOfVars, err := readScalar(vars)
+	if err != nil {
+		return nil, nil, err
+	}
+	if int(numberOfVars) != len(content.Columns) {
+		return nil, nil, fmt.Errorf("Table contains %d of %d variables", len(content.Columns), int(numberOfVars))
+	}
+
+	varNames, err := s.property(object, names["varNames"], depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	if content.VariableNames, err = readCellStrings(varNames); err != nil {
+		return nil, nil, err
+	}
+	if len(content.VariableNames) != len(content.Columns) {
+		return nil, nil, fmt.Errorf("Table contains %d names for %d variables", len(content.VariableNames), len(content.Columns))
+	}
+
+	// Dimension names were introduced with MATLAB R2017a
+	if _, ok := object.Properties[names["dimNames"]]; ok {
+		dimNames, err := s.property(object, names["dimNames"], depth)
+		if err != nil {
+			return nil, nil, err
+		}
+		if content.DimensionNames, err = readCellStrings(dimNames); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if object.Class.String() == "table" {
+		rowNames, err := s.property(object, "rownames", depth)
+		if err != nil {
+			return nil, nil, err
+		}
+		if content.RowNames, err = readCellStrings(rowNames); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		if content.RowTimes, err = s.property(object, "rowTimes", depth); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return Dim{int(numberOfRows), len(content.Columns)}, content, nil
+}
@@ -0,0 +1,121 @@
+package matf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func cellStrings(strs ...string) MatMatrix {
+	var cells []MatMatrix
+	for _, str := range strs {
+		cells = append(cells, MatMatrix{Class: uint32(MxCharClass), Dim: Dim{1, len(str)}, Content: CharPrt{Chars: []string{str}}})
+	}
+	return MatMatrix{Class: uint32(MxCellClass), Dim: Dim{1, len(cells)}, Content: CellPrt{Cells: cells}}
+}
+
+func doubles(values ...float64) MatMatrix {
+	return MatMatrix{Class: uint32(MxDoubleClass), Dim: Dim{len(values), 1}, Content: NumPrt{RealPart: values}}
+}
+
+func TestDecodeTable(t *testing.T) {
+	column := doubles(1, 2, 3)
+	times := doubles(10, 20, 30)
+	fixture := mcosFixture{
+		names: []string{"any", "string", "data", "nrows", "nvars", "varnames", "rownames", "dimnames", "table",
+			"numRows", "numVars", "varNames", "dimNames", "rowTimes", "timetable"},
+		classes: [][2]uint32{{0, 2}, {0, 9}, {0, 15}},
+		objects: [][]uint32{
+			{1, 1, 1, 0},
+			{2, 3, 1, 1, 4, 1, 2, 5, 1, 3, 6, 1, 4, 7, 1, 5, 8, 1, 6},
+			{3, 3, 1, 7, 10, 1, 2, 11, 1, 8, 12, 1, 11, 13, 1, 9, 14, 1, 10},
+		},
+		cells: []MatMatrix{
+			packStrings([]uint64{3, 1}, "x", "y", "z"),
+			{Class: uint32(MxCellClass), Dim: Dim{1, 2}, Content: CellPrt{Cells: []MatMatrix{column, mcosRef(1, []uint32{1, 1}, 1)}}},
+			doubles(3),
+			doubles(2),
+			cellStrings("a", "b"),
+			cellStrings("r1", "r2", "r3"),
+			cellStrings("Row", "Variables"),
+			{Class: uint32(MxCellClass), Dim: Dim{1, 1}, Content: CellPrt{Cells: []MatMatrix{column}}},
+			doubles(1),
+			cellStrings("Time", "Variables"),
+			times,
+			cellStrings("c"),
+		},
+	}
+	elements := readMcosFile(t, []MatMatrix{
+		{Name: "t", Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "table", Metadata: mcosRef(2, []uint32{1, 1}, 2)}},
+		{Name: "tt", Class: uint32(MxOpaqueClass), Content: OpaquePrt{TypeSystem: "MCOS", ClassName: "timetable", Metadata: mcosRef(3, []uint32{1, 1}, 3)}},
+	}, fixture)
+
+	table, ok := elements[0].Content.(Table)
+	if !ok {
+		t.Fatalf("Expected Table, got: %#v", elements[0].Content)
+	}
+	if !reflect.DeepEqual(elements[0].Dim, Dim{3, 2}) {
+		t.Fatalf("Expected dims [3 2], got: %v", elements[0].Dim)
+	}
+	if !reflect.DeepEqual(table.VariableNames, []string{"a", "b"}) || !reflect.DeepEqual(table.RowNames, []string{"r1", "r2", "r3"}) || !reflect.DeepEqual(table.DimensionNames, []string{"Row", "Variables"}) {
+		t.Fatalf("Unexpected names: %#v", table)
+	}
+	if !reflect.DeepEqual(table.Columns[0].Content.(NumPrt).RealPart, []float64{1, 2, 3}) {
+		t.Fatalf("Unexpected first column: %#v", table.Columns[0])
+	}
+	if !reflect.DeepEqual(table.Columns[1].Content, StringPrt{Strings: []string{"x", "y", "z"}}) {
+		t.Fatalf("Unexpected second column: %#v", table.Columns[1])
+	}
+
+	timetable, ok := elements[1].Content.(Table)
+	if !ok {
+		t.Fatalf("Expected Table, got: %#v", elements[1].Content)
+	}
+	if !reflect.DeepEqual(elements[1].Dim, Dim{3, 1}) || !reflect.DeepEqual(timetable.VariableNames, []string{"c"}) {
+		t.Fatalf("Unexpected timetable: %v %#v", elements[1].Dim, timetable)
+	}
+	if !reflect.DeepEqual(timetable.RowTimes.Content.(NumPrt).RealPart, []float64{10, 20, 30}) {
+		t.Fatalf("Unexpected row times: %#v", timetable.RowTimes)
+	}
+}
+
+func TestDecodeTableErrors(t *testing.T) {
+	t.Parallel()
+
+	valid := map[string]MatMatrix{
+		"data":     {Class: uint32(MxCellClass), Dim: Dim{1, 1}, Content: CellPrt{Cells: []MatMatrix{doubles(1)}}},
+		"nrows":    doubles(1),
+		"nvars":    doubles(1),
+		"varnames": cellStrings("a"),
+		"rownames": doubles(),
+	}
+	invalid := func(name string, value MatMatrix) map[string]MatMatrix {
+		properties := make(map[string]MatMatrix)
+		for k, v := range valid {
+			properties[k] = v
+		}
+		properties[name] = value
+		return properties
+	}
+
+	tests := []struct {
+		name   string
+		object McosObject
+		err    bool
+	}{
+		{name: "Valid", object: McosObject{Class: McosClass{Name: "table"}, Properties: valid}},
+		{name: "NoTable", object: McosObject{Class: McosClass{Name: "string"}, Properties: valid}, err: true},
+		{name: "Data", object: McosObject{Class: McosClass{Name: "table"}, Properties: invalid("data", doubles(1))}, err: true},
+		{name: "Vars", object: McosObject{Class: McosClass{Name: "table"}, Properties: invalid("nvars", doubles(2))}, err: true},
+		{name: "VarNames", object: McosObject{Class: McosClass{Name: "table"}, Properties: invalid("varnames", cellStrings("a", "b"))}, err: true},
+		{name: "Rows", object: McosObject{Class: McosClass{Name: "table"}, Properties: invalid("nrows", doubles(1, 2))}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := decodeTable(&Subsystem{}, nil, []McosObject{tc.object}, 0)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+		})
+	}
+}
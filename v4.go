@@ -0,0 +1,343 @@
+package matf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Types of matrices in Level 4 MAT-files
+const (
+	v4FullMatrix   = 0
+	v4TextMatrix   = 1
+	v4SparseMatrix = 2
+)
+
+// v4Precisions maps the precision of a Level 4 matrix to its data type and class
+var v4Precisions = []struct {
+	dataType int
+	class    int
+}{
+	{MiDouble, MxDoubleClass},
+	{MiSingle, MxSingleClass},
+	{MiInt32, MxInt32Class},
+	{MiInt16, MxInt16Class},
+	{MiUint16, MxUint16Class},
+	{MiUint8, MxUint8Class},
+}
+
+// v4Header is the fixed header in front of each matrix of a Level 4 MAT-file
+type v4Header struct {
+	Type       int32 // Encodes the format as decimal digits MOPT.
+	Rows       int32
+	Columns    int32
+	Imaginary  int32 // 1, if the matrix has an imaginary part.
+	NameLength int32 // Length of the name including the terminating NUL.
+}
+
+// machine returns the M digit of the type, that specifies the byte order
+func (h v4Header) machine() int { return int(h.Type) / 1000 }
+
+// precision returns the P digit of the type, that specifies the data type
+func (h v4Header) precision() int { return int(h.Type) / 10 % 10 }
+
+// matrixType returns the T digit of the type, that specifies the kind of matrix
+func (h v4Header) matrixType() int { return int(h.Type) % 10 }
+
+// dataSize returns the number of bytes of the values of the matrix including
+// its imaginary part. It returns an error, if the size exceeds int64.
+func (h v4Header) dataSize() (int64, error) {
+	size := int64(dataTypeSize(v4Precisions[h.precision()].dataType)) * int64(1+h.Imaginary)
+	elements := int64(h.Rows) * int64(h.Columns)
+	if elements > math.MaxInt64/size {
+		return 0, fmt.Errorf("Size of Level 4 matrix with %dx%d elements exceeds the range of int64", h.Rows, h.Columns)
+	}
+	return elements * size, nil
+}
+
+func readV4Header(data []byte, order binary.ByteOrder) v4Header {
+	return v4Header{
+		Type:       int32(order.Uint32(data[0:4])),
+		Rows:       int32(order.Uint32(data[4:8])),
+		Columns:    int32(order.Uint32(data[8:12])),
+		Imaginary:  int32(order.Uint32(data[12:16])),
+		NameLength: int32(order.Uint32(data[16:20])),
+	}
+}
+
+// valid returns true, if the header describes a matrix in the given byte order
+func (h v4Header) valid(order binary.ByteOrder) bool {
+	machine := 0
+	if order == binary.BigEndian {
+		machine = 1
+	}
+	if h.Type < 0 || h.machine() != machine || int(h.Type)/100%10 != 0 {
+		return false
+	}
+	if h.precision() >= len(v4Precisions) || h.matrixType() > v4SparseMatrix {
+		return false
+	}
+	if h.Rows < 0 || h.Columns < 0 || (h.Imaginary != 0 && h.Imaginary != 1) {
+		return false
+	}
+	return h.NameLength > 0
+}
+
+// detectV4 returns the byte order of a Level 4 MAT-file, which does not have
+// a file header but starts with the header of its first matrix.
+func detectV4(data []byte) (binary.ByteOrder, bool) {
+	if len(data) < 20 {
+		return nil, false
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		if readV4Header(data, order).valid(order) {
+			return order, true
+		}
+	}
+	return nil, false
+}
+
+// readV4Values reads numberOfElements values of the given precision
+func readV4Values(m *Matf, order binary.ByteOrder, precision, numberOfElements int) (interface{}, error) {
+	dataType := v4Precisions[precision].dataType
+	numberOfBytes := numberOfElements * dataTypeSize(dataType)
+	if numberOfBytes == 0 {
+		return nil, nil
+	}
+	data, err := readBytes(m, numberOfBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nreadBytes() in readV4Values() failed")
+	}
+	values, _, err := extractDataElement(bytes.NewReader(data), order, dataType, numberOfBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nextractDataElement() in readV4Values() failed")
+	}
+	return values, nil
+}
+
+// readV4Matrix reads the next matrix of a Level 4 MAT-file
+func readV4Matrix(m *Matf, order binary.ByteOrder) (MatMatrix, error) {
+	var mat MatMatrix
+
+	data, err := readBytes(m, 20)
+	if err != nil {
+		return MatMatrix{}, err
+	}
+	header := readV4Header(data, order)
+	if !header.valid(order) {
+		return MatMatrix{}, fmt.Errorf("Invalid header of Level 4 matrix with type %d", header.Type)
+	}
+
+	if int64(header.NameLength) > m.file.Size()-m.offset {
+		return MatMatrix{}, fmt.Errorf("Name of Level 4 matrix with %d bytes exceeds the end of the file", header.NameLength)
+	}
+	name, err := readBytes(m, int(header.NameLength))
+	if err != nil {
+		return MatMatrix{}, errors.Wrap(err, "\nreadBytes() in readV4Matrix() failed")
+	}
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	mat.Name = string(name)
+
+	size, err := header.dataSize()
+	if err != nil {
+		return MatMatrix{}, err
+	}
+	if size > m.file.Size()-m.offset {
+		return MatMatrix{}, fmt.Errorf("Level 4 matrix %s exceeds the end of the file", mat.Name)
+	}
+
+	rows, columns := int(header.Rows), int(header.Columns)
+	re, err := readV4Values(m, order, header.precision(), rows*columns)
+	if err != nil {
+		return MatMatrix{}, err
+	}
+	var im interface{}
+	if header.Imaginary == 1 {
+		if im, err = readV4Values(m, order, header.precision(), rows*columns); err != nil {
+			return MatMatrix{}, err
+		}
+	}
+
+	switch header.matrixType() {
+	case v4FullMatrix:
+		mat.Class = uint32(v4Precisions[header.precision()].class)
+		mat.Dim = Dim{rows, columns}
+		content := NumPrt{RealPart: re, DataType: valuesDataType(re)}
+		if im != nil {
+			mat.Flags = FlagComplex
+			content.ImaginaryPart = im
+		}
+		mat.Content = content
+	case v4TextMatrix:
+		mat.Class = uint32(MxCharClass)
+		mat.Dim = Dim{rows, columns}
+		codes, err := float64s(re)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		chars := make([]rune, len(codes))
+		for i, code := range codes {
+			chars[i] = rune(code)
+		}
+		strs, err := charRows(chars, mat.Dim)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		mat.Content = CharPrt{Chars: strs}
+	case v4SparseMatrix:
+		if err := convertV4Sparse(&mat, re, rows, columns); err != nil {
+			return MatMatrix{}, err
+		}
+	}
+	mat.Flags |= mat.Class
+
+	return mat, nil
+}
+
+// convertV4Sparse converts a Level 4 sparse matrix into a SparsePrt. Level 4
+// files store sparse matrices as table with a row for each nonzero element,
+// that contains its row, column, real and optionally imaginary part. The
+// last row contains the size of the matrix.
+func convertV4Sparse(mat *MatMatrix, values interface{}, rows, columns int) error {
+	var content SparsePrt
+
+	if rows == 0 || (columns != 3 && columns != 4) {
+		return fmt.Errorf("Invalid size of Level 4 sparse matrix: %dx%d", rows, columns)
+	}
+	table, err := float64s(values)
+	if err != nil {
+		return err
+	}
+	column := func(j int) []float64 {
+		return table[j*rows : (j+1)*rows]
+	}
+	nonzeros := rows - 1
+	mat.Class = uint32(MxSparseClass)
+	mat.Dim = Dim{int(column(0)[nonzeros]), int(column(1)[nonzeros])}
+	if mat.Dim[0] < 0 || mat.Dim[1] < 0 {
+		return fmt.Errorf("Invalid dimensions of Level 4 sparse matrix: %v", mat.Dim)
+	}
+
+	// Count the elements of each column first, to support any order
+	content.NzMax = nonzeros
+	content.ColumnPointer = make([]int, mat.Dim[1]+1)
+	for _, j := range column(1)[:nonzeros] {
+		if j < 1 || int(j) > mat.Dim[1] {
+			return fmt.Errorf("Invalid column of Level 4 sparse matrix: %v", j)
+		}
+		content.ColumnPointer[int(j)]++
+	}
+	for j := 1; j < len(content.ColumnPointer); j++ {
+		content.ColumnPointer[j] += content.ColumnPointer[j-1]
+	}
+
+	next := append([]int{}, content.ColumnPointer[:mat.Dim[1]]...)
+	content.RowIndex = make([]int, nonzeros)
+	re := make([]float64, nonzeros)
+	var im []float64
+	if columns == 4 {
+		mat.Flags = FlagComplex
+		im = make([]float64, nonzeros)
+	}
+	for k := 0; k < nonzeros; k++ {
+		i, j := column(0)[k], int(column(1)[k])-1
+		if i < 1 || int(i) > mat.Dim[0] {
+			return fmt.Errorf("Invalid row of Level 4 sparse matrix: %v", i)
+		}
+		content.RowIndex[next[j]] = int(i) - 1
+		re[next[j]] = column(2)[k]
+		if im != nil {
+			im[next[j]] = column(3)[k]
+		}
+		next[j]++
+	}
+	content.RealPart = re
+	if im != nil {
+		content.ImaginaryPart = im
+	}
+	mat.Content = content
+	return nil
+}
+
+// readV4Variables describes the matrices of a Level 4 MAT-file by their
+// headers. Only the size of sparse matrices is read from their last row.
+func readV4Variables(m *Matf, order binary.ByteOrder) ([]Variable, error) {
+	var variables []Variable
+	data := make([]byte, 20)
+	for offset := int64(0); offset < m.file.Size(); {
+		if _, err := m.file.ReadAt(data, offset); err != nil {
+			return nil, errors.Wrap(err, "\nfile.ReadAt() in readV4Variables() failed")
+		}
+		header := readV4Header(data, order)
+		if !header.valid(order) {
+			return nil, fmt.Errorf("Invalid header of Level 4 matrix with type %d", header.Type)
+		}
+		if int64(header.NameLength) > m.file.Size()-offset-20 {
+			return nil, fmt.Errorf("Name of Level 4 matrix with %d bytes exceeds the end of the file", header.NameLength)
+		}
+		name := make([]byte, header.NameLength)
+		if _, err := m.file.ReadAt(name, offset+20); err != nil {
+			return nil, errors.Wrap(err, "\nfile.ReadAt() in readV4Variables() failed")
+		}
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+
+		rows, columns := int(header.Rows), int(header.Columns)
+		dataType := v4Precisions[header.precision()].dataType
+		size := int64(dataTypeSize(dataType))
+		start := offset + 20 + int64(header.NameLength)
+		variable := Variable{Name: string(name), Dim: Dim{rows, columns}, Offset: offset}
+		dataSize, err := header.dataSize()
+		if err != nil {
+			return nil, err
+		}
+		variable.Size = 20 + int64(header.NameLength) + dataSize
+		if dataSize > m.file.Size()-start {
+			return nil, fmt.Errorf("Level 4 matrix %s exceeds the end of the file", variable.Name)
+		}
+
+		switch header.matrixType() {
+		case v4FullMatrix:
+			variable.Class = uint32(v4Precisions[header.precision()].class)
+			if header.Imaginary == 1 {
+				variable.Flags = FlagComplex
+			}
+		case v4TextMatrix:
+			variable.Class = uint32(MxCharClass)
+		case v4SparseMatrix:
+			if rows == 0 || (columns != 3 && columns != 4) {
+				return nil, fmt.Errorf("Invalid size of Level 4 sparse matrix: %dx%d", rows, columns)
+			}
+			variable.Class = uint32(MxSparseClass)
+			if columns == 4 {
+				variable.Flags = FlagComplex
+			}
+			// The last row contains the size of the matrix
+			for j := range variable.Dim {
+				raw := make([]byte, size)
+				if _, err := m.file.ReadAt(raw, start+(int64(j+1)*int64(rows)-1)*size); err != nil {
+					return nil, errors.Wrap(err, "\nfile.ReadAt() in readV4Variables() failed")
+				}
+				value, _, err := extractDataElement(bytes.NewReader(raw), order, dataType, int(size))
+				if err != nil {
+					return nil, errors.Wrap(err, "\nextractDataElement() in readV4Variables() failed")
+				}
+				dim, err := float64s(value)
+				if err != nil || len(dim) != 1 {
+					return nil, fmt.Errorf("Invalid dimensions of Level 4 sparse matrix")
+				}
+				variable.Dim[j] = int(dim[0])
+			}
+		}
+		variable.Flags |= variable.Class
+		variables = append(variables, variable)
+		offset += variable.Size
+	}
+	return variables, nil
+}
@@ -0,0 +1,151 @@
+package matf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func packV4(buf *bytes.Buffer, order binary.ByteOrder, header v4Header, name string, values interface{}) {
+	binary.Write(buf, order, header)
+	buf.WriteString(name)
+	buf.WriteByte(0)
+	binary.Write(buf, order, values)
+}
+
+func TestDetectV4(t *testing.T) {
+	t.Parallel()
+
+	le := new(bytes.Buffer)
+	packV4(le, binary.LittleEndian, v4Header{Type: 0, Rows: 1, Columns: 1, NameLength: 2}, "x", []float64{1})
+	be := new(bytes.Buffer)
+	packV4(be, binary.BigEndian, v4Header{Type: 1020, Rows: 1, Columns: 1, NameLength: 2}, "x", []int32{1})
+	vax := new(bytes.Buffer)
+	packV4(vax, binary.LittleEndian, v4Header{Type: 2000, Rows: 1, Columns: 1, NameLength: 2}, "x", []float64{1})
+
+	tests := []struct {
+		name  string
+		data  []byte
+		order binary.ByteOrder
+		ok    bool
+	}{
+		{name: "LittleEndian", data: le.Bytes(), order: binary.LittleEndian, ok: true},
+		{name: "BigEndian", data: be.Bytes(), order: binary.BigEndian, ok: true},
+		{name: "VAX", data: vax.Bytes()},
+		{name: "Level5", data: matfHeader},
+		{name: "Short", data: noMatf},
+		{name: "Zeros", data: make([]byte, 20)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			order, ok := detectV4(tc.data)
+			if ok != tc.ok || order != tc.order {
+				t.Fatalf("Expected: %v %v\tGot: %v %v", tc.order, tc.ok, order, ok)
+			}
+		})
+	}
+}
+
+func TestReadV4(t *testing.T) {
+	t.Parallel()
+
+	tdir, err := ioutil.TempDir("", "TestReadV4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	full := MatMatrix{Name: "full", Flags: uint32(MxDoubleClass), Class: uint32(MxDoubleClass), Dim: Dim{2, 2},
+		Content: NumPrt{RealPart: []float64{1, 2, 3, 4}, DataType: MiDouble}}
+	complexInt := MatMatrix{Name: "z", Flags: FlagComplex | uint32(MxInt16Class), Class: uint32(MxInt16Class), Dim: Dim{1, 2},
+		Content: NumPrt{RealPart: []int16{1, -2}, ImaginaryPart: []int16{3, 4}, DataType: MiInt16}}
+	text := MatMatrix{Name: "text", Flags: uint32(MxCharClass), Class: uint32(MxCharClass), Dim: Dim{2, 3},
+		Content: CharPrt{Chars: []string{"abc", "def"}}}
+	sparse := MatMatrix{Name: "sparse", Flags: uint32(MxSparseClass), Class: uint32(MxSparseClass), Dim: Dim{3, 2},
+		Content: SparsePrt{RowIndex: []int{2, 0, 1}, ColumnPointer: []int{0, 1, 3}, NzMax: 3, RealPart: []float64{5, 6, 7}}}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		machine := int32(0)
+		if order == binary.BigEndian {
+			machine = 1000
+		}
+		var buf bytes.Buffer
+		packV4(&buf, order, v4Header{Type: machine, Rows: 2, Columns: 2, NameLength: 5}, "full", []float64{1, 2, 3, 4})
+		packV4(&buf, order, v4Header{Type: machine + 30, Rows: 1, Columns: 2, Imaginary: 1, NameLength: 2}, "z", []int16{1, -2, 3, 4})
+		packV4(&buf, order, v4Header{Type: machine + 51, Rows: 2, Columns: 3, NameLength: 5}, "text", []uint8("adbecf"))
+		// Elements of the sparse matrix are not sorted by column
+		packV4(&buf, order, v4Header{Type: machine + 2, Rows: 4, Columns: 3, NameLength: 7}, "sparse",
+			[]float64{1, 3, 2, 3, 2, 1, 2, 2, 6, 5, 7, 0})
+
+		name := filepath.Join(tdir, order.String()+".mat")
+		if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mat, err := Open(name)
+		if err != nil {
+			t.Fatalf("Open() failed: %v", err)
+		}
+		for _, expected := range []MatMatrix{full, complexInt, text, sparse} {
+			element, err := ReadDataElement(mat)
+			if err != nil {
+				t.Fatalf("ReadDataElement() failed: %v", err)
+			}
+			if !reflect.DeepEqual(element, expected) {
+				t.Fatalf("Expected: %#v\nGot: %#v", expected, element)
+			}
+		}
+		if _, err := ReadDataElement(mat); err != io.EOF {
+			t.Fatalf("Expected io.EOF, got: %v", err)
+		}
+		Close(mat)
+	}
+}
+
+func TestReadV4Errors(t *testing.T) {
+	t.Parallel()
+
+	tdir, err := ioutil.TempDir("", "TestReadV4Errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	tests := []struct {
+		name   string
+		header v4Header
+		values interface{}
+	}{
+		{name: "HugeDims", header: v4Header{Rows: 1 << 20, Columns: 1 << 20, NameLength: 2}, values: []float64{1, 2}},
+		{name: "OverflowDims", header: v4Header{Rows: 1<<31 - 1, Columns: 1<<31 - 1, Imaginary: 1, NameLength: 2}, values: []float64{1}},
+		{name: "Truncated", header: v4Header{Rows: 2, Columns: 2, NameLength: 2}, values: []float64{1, 2, 3}},
+		{name: "HugeName", header: v4Header{Rows: 1, Columns: 1, NameLength: 1<<31 - 1}, values: []float64{1}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			packV4(&buf, binary.LittleEndian, tc.header, "x", tc.values)
+			name := filepath.Join(tdir, tc.name+".mat")
+			if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			mat, err := Open(name)
+			if err != nil {
+				t.Fatalf("Open() failed: %v", err)
+			}
+			defer Close(mat)
+			if _, err := ReadDataElement(mat); err == nil {
+				t.Fatalf("Expected error from ReadDataElement(), got none")
+			}
+			if _, err := mat.Variables(); err == nil {
+				t.Fatalf("Expected error from Variables(), got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,697 @@
+package matf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// v73Classes maps the MATLAB_class attribute of MAT-files in version 7.3 to
+// the class of an array.
+var v73Classes = map[string]int{
+	"cell":    MxCellClass,
+	"struct":  MxStructClass,
+	"char":    MxCharClass,
+	"logical": MxUint8Class,
+	"double":  MxDoubleClass,
+	"single":  MxSingleClass,
+	"int8":    MxInt8Class,
+	"uint8":   MxUint8Class,
+	"int16":   MxInt16Class,
+	"uint16":  MxUint16Class,
+	"int32":   MxInt32Class,
+	"uint32":  MxUint32Class,
+	"int64":   MxInt64Class,
+	"uint64":  MxUint64Class,
+}
+
+// v73Reader reads the variables of a MAT-file in version 7.3, which is a
+// HDF5 file behind a 512 byte header.
+type v73Reader struct {
+	file      *hdf5File
+	variables []hdf5Link // Members of the root group, that are variables.
+	next      int        // Index of the next variable to read.
+	subsystem uint64     // Address of the group #subsystem#, 0 if there is none.
+}
+
+func newV73Reader(r io.ReaderAt, size int64) (*v73Reader, error) {
+	file, err := openHDF5(r, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nopenHDF5() in newV73Reader() failed")
+	}
+	root, err := file.readObject(file.root)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nreadObject() in newV73Reader() failed")
+	}
+	links, err := file.links(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nlinks() in newV73Reader() failed")
+	}
+	reader := &v73Reader{file: file}
+	for _, link := range links {
+		if link.name == "#subsystem#" {
+			reader.subsystem = link.address
+		}
+		// Groups like #refs# and #subsystem# contain referenced data
+		if strings.HasPrefix(link.name, "#") {
+			continue
+		}
+		reader.variables = append(reader.variables, link)
+	}
+	return reader, nil
+}
+
+// readNext returns the next variable or io.EOF, if there are no more
+func (r *v73Reader) readNext() (MatMatrix, error) {
+	if r.next >= len(r.variables) {
+		return MatMatrix{}, io.EOF
+	}
+	link := r.variables[r.next]
+	r.next++
+	mat, err := r.readArray(link.address, 0)
+	if err != nil {
+		return MatMatrix{}, errors.Wrap(err, fmt.Sprintf("\nreadArray() for variable %s failed", link.name))
+	}
+	mat.Name = link.name
+	return mat, nil
+}
+
+// readSubsystem parses the dataset MCOS in the group #subsystem#. Like the
+// FileWrapper__ object of other MAT-files, it references the cells with the
+// metadata and the property values of all objects. It returns nil, if the
+// file does not contain objects.
+func (r *v73Reader) readSubsystem() (*Subsystem, error) {
+	if r.subsystem == 0 {
+		return nil, nil
+	}
+	group, err := r.file.readObject(r.subsystem)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nreadObject() in readSubsystem() failed")
+	}
+	links, err := r.file.links(group)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nlinks() in readSubsystem() failed")
+	}
+	var address uint64
+	for _, link := range links {
+		if link.name == "MCOS" {
+			address = link.address
+		}
+	}
+	if address == 0 {
+		// No MCOS objects stored
+		return &Subsystem{}, nil
+	}
+
+	object, err := r.file.readObject(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nreadObject() in readSubsystem() failed")
+	}
+	attrs, err := r.file.attributes(object)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nattributes() in readSubsystem() failed")
+	}
+	if className, err := r.attrString(attrs, "MATLAB_class"); err != nil || className != "FileWrapper__" {
+		return nil, fmt.Errorf("Unexpected MCOS content in subsystem data")
+	}
+	dataset, err := r.file.dataset(object)
+	if err != nil {
+		return nil, errors.Wrap(err, "\ndataset() in readSubsystem() failed")
+	}
+	if dataset.datatype.class != hdf5Reference {
+		return nil, fmt.Errorf("Expected references in MCOS content, got class %d", dataset.datatype.class)
+	}
+	data, err := r.file.read(dataset)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nread() in readSubsystem() failed")
+	}
+	var cells []MatMatrix
+	b := &hdf5Buffer{f: r.file, data: data}
+	for i := uint64(0); i < dataset.space.elements; i++ {
+		cell, err := r.readArray(b.address(), 1)
+		if err != nil {
+			return nil, errors.Wrap(err, "\nreadArray() in readSubsystem() failed")
+		}
+		cells = append(cells, cell)
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(cells) < 2 {
+		return nil, fmt.Errorf("Unexpected MCOS metadata in subsystem data")
+	}
+	metadata, err := readUint8s(cells[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "\nreadUint8s() in readSubsystem() failed")
+	}
+	// HDF5 based MAT-files are always written in little endian
+	return parseMcosMetadata(metadata, binary.LittleEndian, cells)
+}
+
+// v73Dims returns the dimensions of a dataset in MATLAB's order
+func v73Dims(space hdf5Space) Dim {
+	var dims Dim
+	// MATLAB stores its arrays column by column, HDF5 row by row
+	for i := len(space.dims) - 1; i >= 0; i-- {
+		dims = append(dims, int(space.dims[i]))
+	}
+	switch len(dims) {
+	case 0:
+		return Dim{1, 1}
+	case 1:
+		return append(dims, 1)
+	}
+	return dims
+}
+
+// attrString returns the value of a string attribute or an empty string, if
+// the attribute does not exist.
+func (r *v73Reader) attrString(attrs map[string]hdf5Attr, name string) (string, error) {
+	attr, ok := attrs[name]
+	if !ok {
+		return "", nil
+	}
+	strs, err := r.file.strings(attr)
+	if err != nil {
+		return "", err
+	}
+	if len(strs) != 1 {
+		return "", fmt.Errorf("Expected a single string in attribute %s, got %d", name, len(strs))
+	}
+	return strs[0], nil
+}
+
+// attrScalar returns the value of a numeric scalar attribute
+func attrScalar(attrs map[string]hdf5Attr, name string) (float64, bool, error) {
+	attr, ok := attrs[name]
+	if !ok {
+		return 0, false, nil
+	}
+	values, err := attr.datatype.decode(attr.data)
+	if err != nil {
+		return 0, true, err
+	}
+	floats, err := float64s(values)
+	if err != nil {
+		return 0, true, err
+	}
+	if len(floats) != 1 {
+		return 0, true, fmt.Errorf("Expected a single value in attribute %s, got %d", name, len(floats))
+	}
+	return floats[0], true, nil
+}
+
+// decodeComplex splits the values of a compound type with the members real
+// and imag.
+func decodeComplex(datatype hdf5Type, data []byte) (interface{}, interface{}, error) {
+	var parts [2]interface{}
+	for i, name := range []string{"real", "imag"} {
+		var member *hdf5Member
+		for j := range datatype.members {
+			if datatype.members[j].name == name {
+				member = &datatype.members[j]
+			}
+		}
+		if member == nil || member.offset+member.datatype.size > datatype.size {
+			return nil, nil, fmt.Errorf("Compound type has no valid member %s", name)
+		}
+		var raw []byte
+		for k := 0; k+datatype.size <= len(data); k += datatype.size {
+			raw = append(raw, data[k+member.offset:k+member.offset+member.datatype.size]...)
+		}
+		values, err := member.datatype.decode(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		parts[i] = values
+	}
+	return parts[0], parts[1], nil
+}
+
+// decodeNumeric decodes real or complex values
+func decodeNumeric(datatype hdf5Type, data []byte) (NumPrt, uint32, error) {
+	var content NumPrt
+	var err error
+	if datatype.class == hdf5Compound {
+		re, im, err := decodeComplex(datatype, data)
+		content.RealPart, content.ImaginaryPart = re, im
+		content.DataType = valuesDataType(re)
+		return content, FlagComplex, err
+	}
+	content.RealPart, err = datatype.decode(data)
+	content.DataType = valuesDataType(content.RealPart)
+	return content, 0, err
+}
+
+// readArray converts a group or dataset into a MatMatrix
+func (r *v73Reader) readArray(address uint64, depth int) (MatMatrix, error) {
+	var mat MatMatrix
+
+	if depth > maxObjectDepth {
+		return MatMatrix{}, fmt.Errorf("Arrays are nested deeper than %d levels", maxObjectDepth)
+	}
+	object, err := r.file.readObject(address)
+	if err != nil {
+		return MatMatrix{}, err
+	}
+	attrs, err := r.file.attributes(object)
+	if err != nil {
+		return MatMatrix{}, err
+	}
+	className, err := r.attrString(attrs, "MATLAB_class")
+	if err != nil {
+		return MatMatrix{}, err
+	}
+
+	if object.isGroup() {
+		if _, ok := attrs["MATLAB_sparse"]; ok {
+			return r.readSparse(object, className, attrs)
+		}
+		if className != "struct" && className != "" {
+			return MatMatrix{}, fmt.Errorf("Class %s is not supported", className)
+		}
+		return r.readStruct(object, attrs, depth)
+	}
+
+	dataset, err := r.file.dataset(object)
+	if err != nil {
+		return MatMatrix{}, err
+	}
+	data, err := r.file.read(dataset)
+	if err != nil {
+		return MatMatrix{}, err
+	}
+
+	// Objects are references into the subsystem data
+	if _, ok := attrs["MATLAB_object_decode"]; ok {
+		metadata := MatMatrix{Class: uint32(MxUint32Class), Flags: uint32(MxUint32Class), Dim: v73Dims(dataset.space)}
+		if metadata.Content, _, err = decodeNumeric(dataset.datatype, data); err != nil {
+			return MatMatrix{}, err
+		}
+		mat.Class = uint32(MxOpaqueClass)
+		mat.Flags = mat.Class
+		mat.Content = OpaquePrt{TypeSystem: "MCOS", ClassName: className, Metadata: metadata}
+		return mat, nil
+	}
+
+	class, ok := v73Classes[className]
+	if !ok {
+		return MatMatrix{}, fmt.Errorf("Class %q is not supported", className)
+	}
+	mat.Class = uint32(class)
+	mat.Dim = v73Dims(dataset.space)
+	if className == "logical" {
+		mat.Flags = FlagLogical
+	}
+
+	// Empty arrays store their dimensions instead of data
+	if empty, _, err := attrScalar(attrs, "MATLAB_empty"); err != nil {
+		return MatMatrix{}, err
+	} else if empty != 0 {
+		values, err := dataset.datatype.decode(data)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		if mat.Dim, err = readDimensions(values); err != nil {
+			return MatMatrix{}, err
+		}
+		switch class {
+		case MxCellClass:
+			mat.Content = CellPrt{}
+		case MxStructClass:
+			content := StructPrt{FieldValues: make(map[string][]interface{})}
+			if attr, ok := attrs["MATLAB_fields"]; ok {
+				if content.FieldNames, err = r.file.strings(attr); err != nil {
+					return MatMatrix{}, err
+				}
+			}
+			mat.Content = content
+		case MxCharClass:
+			mat.Content = CharPrt{}
+		default:
+			mat.Content = NumPrt{}
+		}
+		mat.Flags |= mat.Class
+		return mat, nil
+	}
+
+	switch class {
+	case MxCellClass:
+		if dataset.datatype.class != hdf5Reference {
+			return MatMatrix{}, fmt.Errorf("Expected references in cell array, got class %d", dataset.datatype.class)
+		}
+		var content CellPrt
+		b := &hdf5Buffer{f: r.file, data: data}
+		for i := uint64(0); i < dataset.space.elements; i++ {
+			cell, err := r.readArray(b.address(), depth+1)
+			if err != nil {
+				return MatMatrix{}, err
+			}
+			content.Cells = append(content.Cells, cell)
+		}
+		if b.err != nil {
+			return MatMatrix{}, b.err
+		}
+		mat.Content = content
+	case MxCharClass:
+		values, err := dataset.datatype.decode(data)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		codes, err := ints(values)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		var chars []rune
+		for _, v := range codes {
+			chars = append(chars, rune(v))
+		}
+		strs, err := charRows(chars, mat.Dim)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		mat.Content = CharPrt{Chars: strs}
+	case MxStructClass:
+		return MatMatrix{}, fmt.Errorf("Expected group for struct, got dataset")
+	default:
+		content, flags, err := decodeNumeric(dataset.datatype, data)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		mat.Flags |= flags
+		mat.Content = content
+	}
+	mat.Flags |= mat.Class
+
+	return mat, nil
+}
+
+// readStruct converts a group into a struct. Fields of struct arrays are
+// datasets of references to the value of each element.
+func (r *v73Reader) readStruct(object *hdf5Object, attrs map[string]hdf5Attr, depth int) (MatMatrix, error) {
+	mat := MatMatrix{Class: uint32(MxStructClass), Flags: uint32(MxStructClass), Dim: Dim{1, 1}}
+	content := StructPrt{FieldValues: make(map[string][]interface{})}
+
+	links, err := r.file.links(object)
+	if err != nil {
+		return MatMatrix{}, err
+	}
+	addresses := make(map[string]uint64)
+	for _, link := range links {
+		addresses[link.name] = link.address
+		content.FieldNames = append(content.FieldNames, link.name)
+	}
+	// MATLAB_fields keeps the original order of the fields
+	if attr, ok := attrs["MATLAB_fields"]; ok {
+		if content.FieldNames, err = r.file.strings(attr); err != nil {
+			return MatMatrix{}, err
+		}
+	}
+	if empty, _, err := attrScalar(attrs, "MATLAB_empty"); err != nil {
+		return MatMatrix{}, err
+	} else if empty != 0 {
+		mat.Dim = Dim{0, 0}
+		mat.Content = content
+		return mat, nil
+	}
+
+	for _, name := range content.FieldNames {
+		address, ok := addresses[name]
+		if !ok {
+			return MatMatrix{}, fmt.Errorf("Field %s is missing", name)
+		}
+		field, err := r.file.readObject(address)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		fieldAttrs, err := r.file.attributes(field)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		if _, ok := fieldAttrs["MATLAB_class"]; ok || field.isGroup() {
+			value, err := r.readArray(address, depth+1)
+			if err != nil {
+				return MatMatrix{}, err
+			}
+			content.FieldValues[name] = append(content.FieldValues[name], value)
+			continue
+		}
+
+		// Field of a struct array
+		dataset, err := r.file.dataset(field)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		if dataset.datatype.class != hdf5Reference {
+			return MatMatrix{}, fmt.Errorf("Field %s has no class", name)
+		}
+		data, err := r.file.read(dataset)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		mat.Dim = v73Dims(dataset.space)
+		b := &hdf5Buffer{f: r.file, data: data}
+		for i := uint64(0); i < dataset.space.elements; i++ {
+			value, err := r.readArray(b.address(), depth+1)
+			if err != nil {
+				return MatMatrix{}, err
+			}
+			content.FieldValues[name] = append(content.FieldValues[name], value)
+		}
+		if b.err != nil {
+			return MatMatrix{}, b.err
+		}
+	}
+	mat.Content = content
+	return mat, nil
+}
+
+// readSparse converts a group with the datasets data, ir and jc into a sparse
+// array. The attribute MATLAB_sparse contains the number of rows.
+func (r *v73Reader) readSparse(object *hdf5Object, className string, attrs map[string]hdf5Attr) (MatMatrix, error) {
+	var content SparsePrt
+	mat := MatMatrix{Class: uint32(MxSparseClass), Flags: uint32(MxSparseClass)}
+
+	rows, _, err := attrScalar(attrs, "MATLAB_sparse")
+	if err != nil {
+		return MatMatrix{}, err
+	}
+	links, err := r.file.links(object)
+	if err != nil {
+		return MatMatrix{}, err
+	}
+	datasets := make(map[string]hdf5Dataset)
+	values := make(map[string][]byte)
+	for _, link := range links {
+		member, err := r.file.readObject(link.address)
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		if datasets[link.name], err = r.file.dataset(member); err != nil {
+			return MatMatrix{}, err
+		}
+		if values[link.name], err = r.file.read(datasets[link.name]); err != nil {
+			return MatMatrix{}, err
+		}
+	}
+
+	jc, ok := datasets["jc"]
+	if !ok {
+		return MatMatrix{}, fmt.Errorf("Sparse array has no column pointers")
+	}
+	pointers, err := jc.datatype.decode(values["jc"])
+	if err != nil {
+		return MatMatrix{}, err
+	}
+	if content.ColumnPointer, err = ints(pointers); err != nil {
+		return MatMatrix{}, err
+	}
+	if len(content.ColumnPointer) == 0 {
+		return MatMatrix{}, fmt.Errorf("Sparse array has no column pointers")
+	}
+	mat.Dim = Dim{int(rows), len(content.ColumnPointer) - 1}
+
+	// Arrays without nonzero elements do not contain ir and data
+	if ir, ok := datasets["ir"]; ok {
+		indices, err := ir.datatype.decode(values["ir"])
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		if content.RowIndex, err = ints(indices); err != nil {
+			return MatMatrix{}, err
+		}
+	}
+	content.NzMax = len(content.RowIndex)
+	if data, ok := datasets["data"]; ok {
+		numeric, flags, err := decodeNumeric(data.datatype, values["data"])
+		if err != nil {
+			return MatMatrix{}, err
+		}
+		mat.Flags |= flags
+		content.RealPart = numeric.RealPart
+		content.ImaginaryPart = numeric.ImaginaryPart
+	}
+	if className == "logical" {
+		mat.Flags |= FlagLogical
+		if content.RealPart, err = bools(content.RealPart); err != nil {
+			return MatMatrix{}, err
+		}
+	}
+	mat.Content = content
+	return mat, nil
+}
+
+// variablesList describes the variables by the attributes and dataspaces of
+// their HDF5 objects without reading their data.
+func (r *v73Reader) variablesList() ([]Variable, error) {
+	var variables []Variable
+	for _, link := range r.variables {
+		variable, err := r.describe(link.address)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("\ndescribe() for variable %s failed", link.name))
+		}
+		variable.Name = link.name
+		variable.Offset = r.file.base + int64(link.address)
+		variables = append(variables, variable)
+	}
+	return variables, nil
+}
+
+// describe returns class, flags and dimensions of the array at address
+func (r *v73Reader) describe(address uint64) (Variable, error) {
+	var variable Variable
+
+	object, err := r.file.readObject(address)
+	if err != nil {
+		return Variable{}, err
+	}
+	attrs, err := r.file.attributes(object)
+	if err != nil {
+		return Variable{}, err
+	}
+	className, err := r.attrString(attrs, "MATLAB_class")
+	if err != nil {
+		return Variable{}, err
+	}
+	if className == "logical" {
+		variable.Flags = FlagLogical
+	}
+	empty, _, err := attrScalar(attrs, "MATLAB_empty")
+	if err != nil {
+		return Variable{}, err
+	}
+
+	if object.isGroup() {
+		links, err := r.file.links(object)
+		if err != nil {
+			return Variable{}, err
+		}
+		datasets := make(map[string]hdf5Dataset)
+		for _, link := range links {
+			member, err := r.file.readObject(link.address)
+			if err != nil {
+				return Variable{}, err
+			}
+			if member.isGroup() {
+				continue
+			}
+			memberAttrs, err := r.file.attributes(member)
+			if err != nil {
+				return Variable{}, err
+			}
+			if _, ok := memberAttrs["MATLAB_class"]; ok {
+				continue
+			}
+			if datasets[link.name], err = r.file.dataset(member); err != nil {
+				return Variable{}, err
+			}
+		}
+
+		if _, ok := attrs["MATLAB_sparse"]; ok {
+			rows, _, err := attrScalar(attrs, "MATLAB_sparse")
+			if err != nil {
+				return Variable{}, err
+			}
+			jc, ok := datasets["jc"]
+			if !ok || jc.space.elements == 0 {
+				return Variable{}, fmt.Errorf("Sparse array has no column pointers")
+			}
+			variable.Class = uint32(MxSparseClass)
+			variable.Dim = Dim{int(rows), int(jc.space.elements) - 1}
+			if data, ok := datasets["data"]; ok {
+				if data.datatype.class == hdf5Compound {
+					variable.Flags |= FlagComplex
+				}
+				variable.Compressed = len(data.filters) > 0
+			}
+		} else {
+			variable.Class = uint32(MxStructClass)
+			variable.Dim = Dim{1, 1}
+			if empty != 0 {
+				variable.Dim = Dim{0, 0}
+			}
+			// Fields of struct arrays are datasets of references
+			for _, dataset := range datasets {
+				variable.Dim = v73Dims(dataset.space)
+				break
+			}
+		}
+		variable.Flags |= variable.Class
+		return variable, nil
+	}
+
+	dataset, err := r.file.dataset(object)
+	if err != nil {
+		return Variable{}, err
+	}
+	variable.Dim = v73Dims(dataset.space)
+	variable.Compressed = len(dataset.filters) > 0
+	if _, ok := attrs["MATLAB_object_decode"]; ok {
+		variable.Class = uint32(MxOpaqueClass)
+		variable.Flags = variable.Class
+		return variable, nil
+	}
+	class, ok := v73Classes[className]
+	if !ok {
+		return Variable{}, fmt.Errorf("Class %q is not supported", className)
+	}
+	variable.Class = uint32(class)
+	if dataset.datatype.class == hdf5Compound {
+		variable.Flags |= FlagComplex
+	}
+	// Empty arrays store their dimensions instead of data
+	if empty != 0 {
+		data, err := r.file.read(dataset)
+		if err != nil {
+			return Variable{}, err
+		}
+		values, err := dataset.datatype.decode(data)
+		if err != nil {
+			return Variable{}, err
+		}
+		if variable.Dim, err = readDimensions(values); err != nil {
+			return Variable{}, err
+		}
+	}
+	variable.Flags |= variable.Class
+	return variable, nil
+}
+
+// get reads the variable name
+func (r *v73Reader) get(name string) (MatMatrix, error) {
+	for _, link := range r.variables {
+		if link.name != name {
+			continue
+		}
+		mat, err := r.readArray(link.address, 0)
+		if err != nil {
+			return MatMatrix{}, errors.Wrap(err, fmt.Sprintf("\nreadArray() for variable %s failed", name))
+		}
+		mat.Name = name
+		return mat, nil
+	}
+	return MatMatrix{}, fmt.Errorf("Variable %s does not exist", name)
+}
@@ -0,0 +1,162 @@
+package matf
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeV73File(t *testing.T, dir string) string {
+	b := newH5Builder()
+
+	// References of cells and struct arrays point into #refs#
+	refChars := b.dataset(h5Fixed(2, false), []uint64{2, 1}, le([]uint16{'h', 'i'}), h5Class("char"))
+	refComplex := b.dataset(h5Complex(h5Float(8), 8), nil, le([]float64{1, -1}), h5Class("double"))
+	refOne := b.dataset(h5Float(8), []uint64{1, 1}, le([]float64{1}), h5Class("double"))
+	refTwo := b.dataset(h5Float(8), []uint64{1, 1}, le([]float64{2}), h5Class("double"))
+	refs := b.group([]h5Link{{"a", refChars}, {"b", refComplex}, {"c", refOne}, {"d", refTwo}})
+
+	double := b.dataset(h5Float(8), []uint64{3, 2}, le([]float64{1, 2, 3, 4, 5, 6}), h5Class("double"))
+	var values []int16
+	for i := int16(0); i < 15; i++ {
+		values = append(values, i)
+	}
+	chunked := b.chunked(t, h5Fixed(2, true), 2, []uint64{3, 5}, []uint64{2, 2}, le(values), h5Class("int16"))
+	cell := b.dataset(h5Reference(), []uint64{2, 1}, le(refChars, refComplex), h5Class("cell"))
+	empty := b.dataset(h5Fixed(8, false), []uint64{2}, le([]uint64{0, 3}), h5Class("double"),
+		h5Attribute("MATLAB_empty", h5Fixed(1, false), nil, []byte{1}))
+	logical := b.dataset(h5Fixed(1, false), []uint64{1, 2}, []byte{1, 0}, h5Class("logical"),
+		h5Attribute("MATLAB_int_decode", h5Fixed(4, true), nil, le(int32(1))))
+
+	x := b.dataset(h5Float(8), []uint64{1, 1}, le([]float64{42}), h5Class("double"))
+	y := b.dataset(h5Fixed(2, false), []uint64{3, 1}, le([]uint16{'a', 'b', 'c'}), h5Class("char"))
+	fields := b.strings("y", "x")
+	structure := b.group([]h5Link{{"x", x}, {"y", y}}, h5Class("struct"),
+		h5Attribute("MATLAB_fields", h5VariableStrings(), []uint64{2}, fields))
+
+	field := b.dataset(h5Reference(), []uint64{2, 1}, le(refOne, refTwo))
+	structArray := b.group([]h5Link{{"v", field}}, h5Class("struct"))
+
+	jc := b.dataset(h5Fixed(8, false), []uint64{3}, le([]uint64{0, 1, 2}), h5Class("uint64"))
+	ir := b.dataset(h5Fixed(8, false), []uint64{2}, le([]uint64{1, 0}), h5Class("uint64"))
+	data := b.dataset(h5Fixed(1, false), []uint64{2}, []byte{1, 1}, h5Class("logical"))
+	sparse := b.group([]h5Link{{"data", data}, {"ir", ir}, {"jc", jc}}, h5Class("logical"),
+		h5Attribute("MATLAB_sparse", h5Fixed(8, false), nil, le(uint64(2))))
+
+	root := b.group([]h5Link{{"#refs#", refs}, {"double", double}, {"chunked", chunked}, {"cell", cell},
+		{"empty", empty}, {"logical", logical}, {"struct", structure}, {"structArray", structArray}, {"sparse", sparse}})
+
+	name := filepath.Join(dir, "v73.mat")
+	if err := ioutil.WriteFile(name, b.finish(root), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestReadV73(t *testing.T) {
+	t.Parallel()
+
+	tdir, err := ioutil.TempDir("", "TestReadV73")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	mat, err := Open(writeV73File(t, tdir))
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer Close(mat)
+
+	chars := MatMatrix{Flags: uint32(MxCharClass), Class: uint32(MxCharClass), Dim: Dim{1, 2}, Content: CharPrt{Chars: []string{"hi"}}}
+	complexScalar := MatMatrix{Flags: FlagComplex | uint32(MxDoubleClass), Class: uint32(MxDoubleClass), Dim: Dim{1, 1},
+		Content: NumPrt{RealPart: []float64{1}, ImaginaryPart: []float64{-1}, DataType: MiDouble}}
+	scalar := func(v float64) MatMatrix {
+		return MatMatrix{Flags: uint32(MxDoubleClass), Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{v}, DataType: MiDouble}}
+	}
+	var chunked []int16
+	for i := int16(0); i < 15; i++ {
+		chunked = append(chunked, i)
+	}
+
+	// Variables are sorted by their name
+	expected := []MatMatrix{
+		{Name: "cell", Flags: uint32(MxCellClass), Class: uint32(MxCellClass), Dim: Dim{1, 2}, Content: CellPrt{Cells: []MatMatrix{chars, complexScalar}}},
+		{Name: "chunked", Flags: uint32(MxInt16Class), Class: uint32(MxInt16Class), Dim: Dim{5, 3}, Content: NumPrt{RealPart: chunked, DataType: MiInt16}},
+		{Name: "double", Flags: uint32(MxDoubleClass), Class: uint32(MxDoubleClass), Dim: Dim{2, 3},
+			Content: NumPrt{RealPart: []float64{1, 2, 3, 4, 5, 6}, DataType: MiDouble}},
+		{Name: "empty", Flags: uint32(MxDoubleClass), Class: uint32(MxDoubleClass), Dim: Dim{0, 3}, Content: NumPrt{}},
+		{Name: "logical", Flags: FlagLogical | uint32(MxUint8Class), Class: uint32(MxUint8Class), Dim: Dim{2, 1},
+			Content: NumPrt{RealPart: []uint8{1, 0}, DataType: MiUint8}},
+		{Name: "sparse", Flags: FlagLogical | uint32(MxSparseClass), Class: uint32(MxSparseClass), Dim: Dim{2, 2},
+			Content: SparsePrt{RowIndex: []int{1, 0}, ColumnPointer: []int{0, 1, 2}, NzMax: 2, RealPart: []bool{true, true}}},
+		{Name: "struct", Flags: uint32(MxStructClass), Class: uint32(MxStructClass), Dim: Dim{1, 1}, Content: StructPrt{
+			FieldNames: []string{"y", "x"},
+			FieldValues: map[string][]interface{}{
+				"x": {scalar(42)},
+				"y": {MatMatrix{Flags: uint32(MxCharClass), Class: uint32(MxCharClass), Dim: Dim{1, 3}, Content: CharPrt{Chars: []string{"abc"}}}},
+			}}},
+		{Name: "structArray", Flags: uint32(MxStructClass), Class: uint32(MxStructClass), Dim: Dim{1, 2}, Content: StructPrt{
+			FieldNames:  []string{"v"},
+			FieldValues: map[string][]interface{}{"v": {scalar(1), scalar(2)}}}},
+	}
+
+	for _, e := range expected {
+		element, err := ReadDataElement(mat)
+		if err != nil {
+			t.Fatalf("ReadDataElement() failed: %v", err)
+		}
+		if !reflect.DeepEqual(element, e) {
+			t.Fatalf("Expected: %#v\nGot: %#v", e, element)
+		}
+	}
+	if _, err := ReadDataElement(mat); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got: %v", err)
+	}
+}
+
+func TestReadV73Errors(t *testing.T) {
+	t.Parallel()
+
+	tdir, err := ioutil.TempDir("", "TestReadV73Errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	unknown := newH5Builder()
+	unknownRoot := unknown.group([]h5Link{{"x", unknown.dataset(h5Float(8), []uint64{1, 1}, le(1.0), h5Class("function_handle"))}})
+	noSuperblock := newH5Builder().finish(0)[:600]
+
+	tests := []struct {
+		name string
+		data []byte
+		open bool
+	}{
+		{name: "UnknownClass", data: unknown.finish(unknownRoot)},
+		{name: "NoSuperblock", data: noSuperblock, open: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(tdir, tc.name+".mat")
+			if err := ioutil.WriteFile(name, tc.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			mat, err := Open(name)
+			if (err != nil) != tc.open {
+				t.Fatalf("Expected error on Open(): %v\tGot: %v", tc.open, err)
+			}
+			if tc.open {
+				return
+			}
+			defer Close(mat)
+			if _, err := ReadDataElement(mat); err == nil {
+				t.Fatalf("Expected error, got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package matf
+
+import (
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// v73Types maps the numeric array classes to the HDF5 datatype of their values
+var v73Types = map[int]hdf5Type{
+	MxDoubleClass: newHDF5Type(hdf5FloatingPoint, 8, true),
+	MxSingleClass: newHDF5Type(hdf5FloatingPoint, 4, true),
+	MxInt8Class:   newHDF5Type(hdf5FixedPoint, 1, true),
+	MxUint8Class:  newHDF5Type(hdf5FixedPoint, 1, false),
+	MxInt16Class:  newHDF5Type(hdf5FixedPoint, 2, true),
+	MxUint16Class: newHDF5Type(hdf5FixedPoint, 2, false),
+	MxInt32Class:  newHDF5Type(hdf5FixedPoint, 4, true),
+	MxUint32Class: newHDF5Type(hdf5FixedPoint, 4, false),
+	MxInt64Class:  newHDF5Type(hdf5FixedPoint, 8, true),
+	MxUint64Class: newHDF5Type(hdf5FixedPoint, 8, false),
+}
+
+// Datatypes of MAT-files in version 7.3, that are not numeric arrays
+var (
+	v73Char       = newHDF5Type(hdf5FixedPoint, 2, false)
+	v73Index      = newHDF5Type(hdf5FixedPoint, 8, false)
+	v73Reference  = hdf5Type{class: hdf5Reference, size: 8}
+	v73FieldNames = hdf5Type{class: hdf5VariableLen, size: 16, base: &hdf5Type{class: hdf5String, size: 1}}
+)
+
+// v73Writer writes the variables of a MAT-file in version 7.3. The elements
+// of cells and struct arrays are stored in the group #refs#.
+type v73Writer struct {
+	h         *hdf5Writer
+	variables []hdf5Link
+	refs      []hdf5Link
+}
+
+// v73ClassName returns the MATLAB_class attribute of an array
+func v73ClassName(class int, flags uint32) string {
+	if flags&FlagLogical == FlagLogical {
+		return "logical"
+	}
+	if class == MxSparseClass {
+		return "double"
+	}
+	for name, c := range v73Classes {
+		if c == class && name != "logical" {
+			return name
+		}
+	}
+	return ""
+}
+
+// v73RefName returns the name of the n-th member of #refs#, like MATLAB uses
+// them: a, b, ..., z, ba, bb, ...
+func v73RefName(n int) string {
+	name := string('a' + rune(n%26))
+	for n /= 26; n > 0; n /= 26 {
+		name = string('a'+rune(n%26)) + name
+	}
+	return name
+}
+
+// hdf5Dims converts the dimensions of an array into HDF5's order
+func hdf5Dims(dims []int) []uint64 {
+	var reversed []uint64
+	for i := len(dims) - 1; i >= 0; i-- {
+		reversed = append(reversed, uint64(dims[i]))
+	}
+	return reversed
+}
+
+func v73Class(name string) []byte {
+	return encodeAttribute("MATLAB_class", hdf5Type{class: hdf5String, size: len(name)}, nil, []byte(name))
+}
+
+// v73IntDecode tells MATLAB, how to interpret integers. 1 marks logical
+// values, 2 UTF-16 characters.
+func v73IntDecode(value int) []byte {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(value))
+	return encodeAttribute("MATLAB_int_decode", newHDF5Type(hdf5FixedPoint, 4, true), nil, data)
+}
+
+// interleave merges the real and imaginary parts into a compound type
+func interleave(re, im []byte, size int) []byte {
+	data := make([]byte, 0, len(re)+len(im))
+	for i := 0; i+size <= len(re); i += size {
+		data = append(data, re[i:i+size]...)
+		data = append(data, im[i:i+size]...)
+	}
+	return data
+}
+
+func v73Complex(t hdf5Type) hdf5Type {
+	return hdf5Type{class: hdf5Compound, size: 2 * t.size, members: []hdf5Member{
+		{name: "real", offset: 0, datatype: t},
+		{name: "imag", offset: t.size, datatype: t},
+	}}
+}
+
+// write stores mat as variable in the root group
+func (v *v73Writer) write(mat MatMatrix, level int) error {
+	if strings.HasPrefix(mat.Name, "#") {
+		return fmt.Errorf("Names of variables must not start with #: %s", mat.Name)
+	}
+	for _, variable := range v.variables {
+		if variable.name == mat.Name {
+			return fmt.Errorf("Variable %s has already been written", mat.Name)
+		}
+	}
+	address, err := v.writeArray(mat, level)
+	if err != nil {
+		return err
+	}
+	v.variables = append(v.variables, hdf5Link{name: mat.Name, address: address})
+	return nil
+}
+
+// writeRefs stores each array in #refs# and returns the references to them
+func (v *v73Writer) writeRefs(mats []MatMatrix, level int) ([]byte, error) {
+	data := make([]byte, 8*len(mats))
+	for i, mat := range mats {
+		address, err := v.writeArray(mat, level)
+		if err != nil {
+			return nil, err
+		}
+		v.refs = append(v.refs, hdf5Link{name: v73RefName(len(v.refs)), address: address})
+		binary.LittleEndian.PutUint64(data[8*i:], address)
+	}
+	return data, nil
+}
+
+// writeEmpty stores the dimensions of an empty array instead of its data
+func (v *v73Writer) writeEmpty(className string, dims []int, attrs ...[]byte) (uint64, error) {
+	data, err := packValues(binary.LittleEndian, MiUint64, dims)
+	if err != nil {
+		return 0, err
+	}
+	attrs = append([][]byte{v73Class(className),
+		encodeAttribute("MATLAB_empty", newHDF5Type(hdf5FixedPoint, 1, false), nil, []byte{1})}, attrs...)
+	return v.h.writeDataset(v73Index, []uint64{uint64(len(dims))}, data, zlib.NoCompression, attrs)
+}
+
+// writeArray stores mat as dataset or group and returns its address
+func (v *v73Writer) writeArray(mat MatMatrix, level int) (uint64, error) {
+	if mat.Class == 0 {
+		mat.Class = mat.Flags & ClassMask
+	}
+	// MATLAB expects at least two dimensions
+	dims := append([]int{}, mat.Dim...)
+	switch len(dims) {
+	case 0:
+		dims = []int{0, 0}
+	case 1:
+		dims = append(dims, 1)
+	}
+	elements := 1
+	for _, dim := range dims {
+		elements *= dim
+	}
+	className := v73ClassName(int(mat.Class), mat.Flags)
+
+	switch int(mat.Class) {
+	case MxCellClass:
+		content, ok := mat.Content.(CellPrt)
+		if !ok {
+			return 0, fmt.Errorf("Content of type %T does not match class %d", mat.Content, mat.Class)
+		}
+		if len(content.Cells) != elements {
+			return 0, fmt.Errorf("Cell array of %d elements contains %d cells", elements, len(content.Cells))
+		}
+		if elements == 0 {
+			return v.writeEmpty(className, dims)
+		}
+		refs, err := v.writeRefs(content.Cells, level)
+		if err != nil {
+			return 0, err
+		}
+		return v.h.writeDataset(v73Reference, hdf5Dims(dims), refs, level, [][]byte{v73Class(className)})
+	case MxStructClass:
+		return v.writeStruct(mat, dims, level)
+	case MxCharClass:
+		content, ok := mat.Content.(CharPrt)
+		if !ok {
+			return 0, fmt.Errorf("Content of type %T does not match class %d", mat.Content, mat.Class)
+		}
+		data, err := packChars(binary.LittleEndian, content.Chars)
+		if err != nil {
+			return 0, err
+		}
+		if len(data) != 2*elements {
+			return 0, fmt.Errorf("Char array of %d elements contains %d characters", elements, len(data)/2)
+		}
+		if elements == 0 {
+			return v.writeEmpty(className, dims)
+		}
+		return v.h.writeDataset(v73Char, hdf5Dims(dims), data, level, [][]byte{v73Class(className), v73IntDecode(2)})
+	case MxSparseClass:
+		return v.writeSparse(mat, dims, className, level)
+	case MxDoubleClass, MxSingleClass, MxInt8Class, MxUint8Class, MxInt16Class,
+		MxUint16Class, MxInt32Class, MxUint32Class, MxInt64Class, MxUint64Class:
+		content, ok := mat.Content.(NumPrt)
+		if !ok {
+			return 0, fmt.Errorf("Content of type %T does not match class %d", mat.Content, mat.Class)
+		}
+		datatype, data, err := v73Numeric(int(mat.Class), mat.Flags, content.RealPart, content.ImaginaryPart)
+		if err != nil {
+			return 0, err
+		}
+		if len(data) != elements*datatype.size {
+			return 0, fmt.Errorf("Array of %d elements contains %d values", elements, len(data)/datatype.size)
+		}
+		if elements == 0 {
+			return v.writeEmpty(className, dims)
+		}
+		attrs := [][]byte{v73Class(className)}
+		if className == "logical" {
+			attrs = append(attrs, v73IntDecode(1))
+		}
+		return v.h.writeDataset(datatype, hdf5Dims(dims), data, level, attrs)
+	default:
+		return 0, fmt.Errorf("Class %d is not supported in MAT-files of version 7.3", mat.Class)
+	}
+}
+
+// v73Numeric converts real and optional imaginary values of a class into the
+// raw data of a HDF5 datatype.
+func v73Numeric(class int, flags uint32, real, imaginary interface{}) (hdf5Type, []byte, error) {
+	datatype := v73Types[class]
+	dataType := classDataType[class]
+	real, imaginary, err := splitComplex(real, imaginary)
+	if err != nil {
+		return datatype, nil, errors.Wrap(err, "\nsplitComplex() in v73Numeric() failed")
+	}
+	data, err := packValues(binary.LittleEndian, dataType, real)
+	if err != nil {
+		return datatype, nil, errors.Wrap(err, "\npackValues() in v73Numeric() failed")
+	}
+	if flags&FlagComplex == FlagComplex || imaginary != nil {
+		im, err := packValues(binary.LittleEndian, dataType, imaginary)
+		if err != nil {
+			return datatype, nil, errors.Wrap(err, "\npackValues() in v73Numeric() failed")
+		}
+		if len(im) != len(data) {
+			return datatype, nil, fmt.Errorf("Real and imaginary part differ in length")
+		}
+		data = interleave(data, im, datatype.size)
+		datatype = v73Complex(datatype)
+	}
+	return datatype, data, nil
+}
+
+// writeStruct stores a struct as group. The fields of struct arrays are
+// datasets of references to the value of each element.
+func (v *v73Writer) writeStruct(mat MatMatrix, dims []int, level int) (uint64, error) {
+	content, ok := mat.Content.(StructPrt)
+	if !ok {
+		return 0, fmt.Errorf("Content of type %T does not match class %d", mat.Content, mat.Class)
+	}
+	var names []string
+	var numberOfValues int
+	for _, name := range content.FieldNames {
+		names = append(names, strings.TrimRight(name, "\x00"))
+		if len(content.FieldValues[name]) > numberOfValues {
+			numberOfValues = len(content.FieldValues[name])
+		}
+	}
+	if len(mat.Dim) == 0 && numberOfValues > 0 {
+		dims = []int{1, numberOfValues}
+	}
+	elements := 1
+	for _, dim := range dims {
+		elements *= dim
+	}
+	if numberOfValues > elements {
+		return 0, fmt.Errorf("Struct array of %d elements contains %d values", elements, numberOfValues)
+	}
+
+	var attrs [][]byte
+	if len(names) > 0 {
+		fields, err := v.h.writeStrings(names)
+		if err != nil {
+			return 0, err
+		}
+		attrs = append(attrs, encodeAttribute("MATLAB_fields", v73FieldNames, []uint64{uint64(len(names))}, fields))
+	}
+	if elements == 0 {
+		return v.writeEmpty("struct", dims, attrs...)
+	}
+
+	var links []hdf5Link
+	for i, name := range content.FieldNames {
+		values := make([]MatMatrix, elements)
+		for j := range values {
+			if j < len(content.FieldValues[name]) {
+				value, ok := content.FieldValues[name][j].(MatMatrix)
+				if !ok {
+					return 0, fmt.Errorf("Value of field %s is not a MatMatrix", name)
+				}
+				values[j] = value
+			} else {
+				// Fields without a value are stored as empty double array
+				values[j] = MatMatrix{Class: uint32(MxDoubleClass), Content: NumPrt{}}
+			}
+		}
+
+		var address uint64
+		var err error
+		if elements == 1 {
+			address, err = v.writeArray(values[0], level)
+		} else {
+			var refs []byte
+			if refs, err = v.writeRefs(values, level); err == nil {
+				address, err = v.h.writeDataset(v73Reference, hdf5Dims(dims), refs, level, nil)
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		links = append(links, hdf5Link{name: names[i], address: address})
+	}
+	address, _, _, err := v.h.writeGroup(links, append([][]byte{v73Class("struct")}, attrs...))
+	return address, err
+}
+
+// writeSparse stores a sparse array as group with the datasets data, ir and
+// jc. The attribute MATLAB_sparse contains the number of rows.
+func (v *v73Writer) writeSparse(mat MatMatrix, dims []int, className string, level int) (uint64, error) {
+	content, ok := mat.Content.(SparsePrt)
+	if !ok {
+		return 0, fmt.Errorf("Content of type %T does not match class %d", mat.Content, mat.Class)
+	}
+	if len(dims) != 2 || len(content.ColumnPointer) != dims[1]+1 {
+		return 0, fmt.Errorf("Sparse array of %v needs %d column pointers, got %d", dims, dims[len(dims)-1]+1, len(content.ColumnPointer))
+	}
+
+	var links []hdf5Link
+	jc, err := packValues(binary.LittleEndian, MiUint64, content.ColumnPointer)
+	if err != nil {
+		return 0, err
+	}
+	address, err := v.h.writeDataset(v73Index, []uint64{uint64(len(content.ColumnPointer))}, jc, level, nil)
+	if err != nil {
+		return 0, err
+	}
+	links = append(links, hdf5Link{name: "jc", address: address})
+
+	// Arrays without nonzero elements do not contain ir and data
+	if len(content.RowIndex) > 0 {
+		ir, err := packValues(binary.LittleEndian, MiUint64, content.RowIndex)
+		if err != nil {
+			return 0, err
+		}
+		address, err := v.h.writeDataset(v73Index, []uint64{uint64(len(content.RowIndex))}, ir, level, nil)
+		if err != nil {
+			return 0, err
+		}
+		links = append(links, hdf5Link{name: "ir", address: address})
+
+		class := MxDoubleClass
+		if className == "logical" {
+			class = MxUint8Class
+		}
+		datatype, data, err := v73Numeric(class, mat.Flags, content.RealPart, content.ImaginaryPart)
+		if err != nil {
+			return 0, err
+		}
+		if len(data) != len(content.RowIndex)*datatype.size {
+			return 0, fmt.Errorf("Sparse array with %d row indices contains %d values", len(content.RowIndex), len(data)/datatype.size)
+		}
+		if address, err = v.h.writeDataset(datatype, []uint64{uint64(len(content.RowIndex))}, data, level, nil); err != nil {
+			return 0, err
+		}
+		links = append(links, hdf5Link{name: "data", address: address})
+	}
+
+	rows := make([]byte, 8)
+	binary.LittleEndian.PutUint64(rows, uint64(dims[0]))
+	attrs := [][]byte{v73Class(className), encodeAttribute("MATLAB_sparse", v73Index, nil, rows)}
+	address, _, _, err = v.h.writeGroup(links, attrs)
+	return address, err
+}
+
+// close writes the group #refs#, the root group and the superblock
+func (v *v73Writer) close() error {
+	links := v.variables
+	if len(v.refs) > 0 {
+		refs, _, _, err := v.h.writeGroup(v.refs, nil)
+		if err != nil {
+			return errors.Wrap(err, "\nwriteGroup() in close() failed")
+		}
+		links = append(links, hdf5Link{name: "#refs#", address: refs})
+	}
+	root, tree, heap, err := v.h.writeGroup(links, nil)
+	if err != nil {
+		return errors.Wrap(err, "\nwriteGroup() in close() failed")
+	}
+	return v.h.writeSuperblock(root, tree, heap)
+}
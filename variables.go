@@ -0,0 +1,237 @@
+package matf
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Variable describes a variable of a MAT-file without its content, like
+// MATLAB's whos does.
+type Variable struct {
+	Name  string
+	Class uint32
+	Flags uint32 // Array flags, that contain FlagComplex, FlagGlobal and FlagLogical.
+	Dim
+	Size       int64 // Number of bytes of the data element in the file, including its tag.
+	Compressed bool  // If set, the data element is stored as miCOMPRESSED.
+	Offset     int64 // Position of the data element in the file.
+}
+
+// describeDataElement extracts the header of the matrix in a data element of
+// dataType. It returns false, if the data element does not contain a matrix.
+func describeDataElement(order binary.ByteOrder, dataType, completeBytes uint32, r io.Reader) (Variable, bool, error) {
+	var variable Variable
+	if dataType == uint32(MiCompressed) {
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return Variable{}, false, errors.Wrap(err, "\nzlib.NewReader() in describeDataElement() failed")
+		}
+		defer zr.Close()
+		tag := make([]byte, 8)
+		if _, err := io.ReadFull(zr, tag); err != nil {
+			return Variable{}, false, errors.Wrap(err, "\nio.ReadFull() in describeDataElement() failed")
+		}
+		dataType = order.Uint32(tag[:4])
+		completeBytes = order.Uint32(tag[4:8])
+		variable.Compressed = true
+		r = zr
+	}
+	if dataType != uint32(MiMatrix) {
+		return Variable{}, false, nil
+	}
+
+	// Data elements within this one can not exceed its size
+	limited := &io.LimitedReader{R: bufio.NewReader(r), N: int64(completeBytes)}
+	mat, _, _, err := extractMatrixHeader(limited, order)
+	if err != nil {
+		return Variable{}, false, errors.Wrap(err, "\nextractMatrixHeader() in describeDataElement() failed")
+	}
+	variable.Name = mat.Name
+	variable.Class = mat.Class
+	variable.Flags = mat.Flags
+	variable.Dim = mat.Dim
+	return variable, true, nil
+}
+
+// Variables returns a description of each variable in the MAT-file. Only the
+// beginning of each data element is read, its content is not extracted.
+// For MAT-files in version 7.3 Offset is the position of the HDF5 object of
+// a variable and Size is 0.
+func (m *Matf) Variables() ([]Variable, error) {
+	if m.version4 {
+		return readV4Variables(m, m.order())
+	}
+	if m.v73 != nil {
+		return m.v73.variablesList()
+	}
+
+	var variables []Variable
+	order := m.order()
+	tag := make([]byte, 8)
+	for offset := int64(128); offset+8 <= m.file.Size(); {
+		if _, err := m.file.ReadAt(tag, offset); err != nil {
+			return nil, errors.Wrap(err, "\nfile.ReadAt() in Variables() failed")
+		}
+		dataType := order.Uint32(tag[:4])
+		completeBytes := int64(order.Uint32(tag[4:8]))
+		if offset+8+completeBytes > m.file.Size() {
+			return nil, fmt.Errorf("Data element of %d bytes at %d exceeds the end of the file", completeBytes, offset)
+		}
+
+		// The subsystem data is not a variable of its own
+		if offset != m.subsystemOffset {
+			variable, ok, err := describeDataElement(order, dataType, uint32(completeBytes), io.NewSectionReader(m.file, offset+8, completeBytes))
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("\ndescribeDataElement() at %d in Variables() failed", offset))
+			}
+			if ok {
+				variable.Offset = offset
+				variable.Size = 8 + completeBytes
+				variables = append(variables, variable)
+			}
+		}
+		offset += 8 + completeBytes
+	}
+	return variables, nil
+}
+
+// Get returns the variable name. On the first call, the position of each
+// variable is collected with Variables(), so that Get reads only the data
+// element of the requested variable. Compressed data elements of the other
+// variables are only inflated as far as it is needed to get their names.
+// Get does not change the position of ReadDataElement.
+func (m *Matf) Get(name string) (MatMatrix, error) {
+	if m.v73 != nil {
+		mat, err := m.v73.get(name)
+		if err != nil || !hasObjects(mat) {
+			return mat, err
+		}
+		return decodeObjects(m, mat)
+	}
+	if m.index == nil {
+		variables, err := m.Variables()
+		if err != nil {
+			return MatMatrix{}, errors.Wrap(err, "\nVariables() in Get() failed")
+		}
+		m.index = make(map[string]Variable)
+		for _, variable := range variables {
+			// MATLAB uses the first one of variables with the same name
+			if _, ok := m.index[variable.Name]; !ok {
+				m.index[variable.Name] = variable
+			}
+		}
+	}
+	variable, ok := m.index[name]
+	if !ok {
+		return MatMatrix{}, fmt.Errorf("Variable %s does not exist", name)
+	}
+	return m.readVariable(variable)
+}
+
+// readVariable reads the data element, that is described by variable
+func (m *Matf) readVariable(variable Variable) (MatMatrix, error) {
+	order := m.order()
+	if m.version4 {
+		// Level 4 matrices are read sequentially from the position of the variable
+		offset := m.offset
+		defer func() {
+			m.offset = offset
+			m.file.Seek(offset, io.SeekStart)
+		}()
+		if _, err := m.file.Seek(variable.Offset, io.SeekStart); err != nil {
+			return MatMatrix{}, errors.Wrap(err, "\nfile.Seek() in readVariable() failed")
+		}
+		m.offset = variable.Offset
+		return readV4Matrix(m, order)
+	}
+
+	dataType := uint32(MiMatrix)
+	if variable.Compressed {
+		dataType = uint32(MiCompressed)
+	}
+	data := io.NewSectionReader(m.file, variable.Offset+8, variable.Size-8)
+	mat, err := parseDataElementField(order, dataType, uint32(variable.Size-8), data)
+	if err != nil {
+		return MatMatrix{}, errors.Wrap(err, "\nparseDataElementField() in readVariable() failed")
+	}
+	if !hasObjects(mat) {
+		return mat, nil
+	}
+	return decodeObjects(m, mat)
+}
+
+// Load returns the variables with the given names, like MATLAB's load does.
+// Without names, all variables are returned. The data elements of other
+// variables are skipped by their size without extracting them.
+func (m *Matf) Load(names ...string) (map[string]MatMatrix, error) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	mats, err := m.load(func(name string) bool {
+		return len(wanted) == 0 || wanted[name]
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "\nload() in Load() failed")
+	}
+	for _, name := range names {
+		if _, ok := mats[name]; !ok {
+			return nil, fmt.Errorf("Variable %s does not exist", name)
+		}
+	}
+	return mats, nil
+}
+
+// LoadMatching returns the variables, whose name matches re, by their name,
+// like MATLAB's load with -regexp does.
+func (m *Matf) LoadMatching(re *regexp.Regexp) (map[string]MatMatrix, error) {
+	mats, err := m.load(re.MatchString)
+	if err != nil {
+		return nil, errors.Wrap(err, "\nload() in LoadMatching() failed")
+	}
+	return mats, nil
+}
+
+// load reads the variables, whose name is accepted by match
+func (m *Matf) load(match func(name string) bool) (map[string]MatMatrix, error) {
+	mats := make(map[string]MatMatrix)
+	if m.v73 != nil {
+		for _, link := range m.v73.variables {
+			if !match(link.name) {
+				continue
+			}
+			mat, err := m.Get(link.name)
+			if err != nil {
+				return nil, err
+			}
+			mats[link.name] = mat
+		}
+		return mats, nil
+	}
+
+	variables, err := m.Variables()
+	if err != nil {
+		return nil, errors.Wrap(err, "\nVariables() in load() failed")
+	}
+	for _, variable := range variables {
+		if !match(variable.Name) {
+			continue
+		}
+		// MATLAB uses the first one of variables with the same name
+		if _, ok := mats[variable.Name]; ok {
+			continue
+		}
+		mat, err := m.readVariable(variable)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("\nreadVariable() for variable %s failed", variable.Name))
+		}
+		mats[variable.Name] = mat
+	}
+	return mats, nil
+}
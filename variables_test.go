@@ -0,0 +1,248 @@
+package matf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func writeVariablesFile(t *testing.T, name string, create func(string) (*Writer, error)) {
+	w, err := create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elements := []MatMatrix{
+		{Name: "double", Class: uint32(MxDoubleClass), Dim: Dim{2, 3}, Content: NumPrt{RealPart: []float64{1, 2, 3, 4, 5, 6}}},
+		{Name: "complex", Class: uint32(MxSingleClass), Flags: FlagComplex, Dim: Dim{1, 2}, Content: NumPrt{RealPart: []float32{1, 2}, ImaginaryPart: []float32{3, 4}}},
+		{Name: "logical", Class: uint32(MxUint8Class), Flags: FlagLogical, Dim: Dim{1, 2}, Content: NumPrt{RealPart: []bool{true, false}}},
+		{Name: "char", Class: uint32(MxCharClass), Dim: Dim{1, 5}, Content: CharPrt{Chars: []string{"hello"}}},
+	}
+	for i, element := range elements {
+		// Only every other element is compressed
+		level := zlib.NoCompression
+		if i%2 == 1 {
+			level = zlib.BestSpeed
+		}
+		if err := w.SetCompression(level); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteDataElement(element); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	t.Parallel()
+
+	tdir, err := ioutil.TempDir("", "TestVariables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	level5 := filepath.Join(tdir, "level5.mat")
+	writeVariablesFile(t, level5, Create)
+	v73 := filepath.Join(tdir, "v73.mat")
+	writeVariablesFile(t, v73, CreateV73)
+
+	var v4 bytes.Buffer
+	packV4(&v4, binary.LittleEndian, v4Header{Type: 0, Rows: 2, Columns: 3, Imaginary: 1, NameLength: 2}, "x", make([]float64, 12))
+	packV4(&v4, binary.LittleEndian, v4Header{Type: 2, Rows: 3, Columns: 3, NameLength: 2}, "s", []float64{1, 2, 4, 1, 3, 5, 1, 1, 0})
+	level4 := filepath.Join(tdir, "level4.mat")
+	if err := ioutil.WriteFile(level4, v4.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	variables := []Variable{
+		{Name: "double", Class: uint32(MxDoubleClass), Flags: uint32(MxDoubleClass), Dim: Dim{2, 3}},
+		{Name: "complex", Class: uint32(MxSingleClass), Flags: FlagComplex | uint32(MxSingleClass), Dim: Dim{1, 2}, Compressed: true},
+		{Name: "logical", Class: uint32(MxUint8Class), Flags: FlagLogical | uint32(MxUint8Class), Dim: Dim{1, 2}},
+		{Name: "char", Class: uint32(MxCharClass), Flags: uint32(MxCharClass), Dim: Dim{1, 5}, Compressed: true},
+	}
+
+	tests := []struct {
+		name      string
+		file      string
+		variables []Variable
+	}{
+		{name: "Level5", file: level5, variables: variables},
+		{name: "Level4", file: level4, variables: []Variable{
+			{Name: "x", Class: uint32(MxDoubleClass), Flags: FlagComplex | uint32(MxDoubleClass), Dim: Dim{2, 3}},
+			{Name: "s", Class: uint32(MxSparseClass), Flags: uint32(MxSparseClass), Dim: Dim{4, 5}},
+		}},
+		// Variables in version 7.3 are sorted by their name
+		{name: "V73", file: v73, variables: []Variable{
+			{Name: "char", Class: uint32(MxCharClass), Flags: uint32(MxCharClass), Dim: Dim{1, 5}, Compressed: true},
+			{Name: "complex", Class: uint32(MxSingleClass), Flags: FlagComplex | uint32(MxSingleClass), Dim: Dim{1, 2}, Compressed: true},
+			{Name: "double", Class: uint32(MxDoubleClass), Flags: uint32(MxDoubleClass), Dim: Dim{2, 3}},
+			{Name: "logical", Class: uint32(MxUint8Class), Flags: FlagLogical | uint32(MxUint8Class), Dim: Dim{1, 2}},
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mat, err := Open(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer Close(mat)
+			info, err := os.Stat(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			variables, err := mat.Variables()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if len(variables) != len(tc.variables) {
+				t.Fatalf("Expected %d variables, got %d", len(tc.variables), len(variables))
+			}
+			for i, variable := range variables {
+				if tc.name != "V73" {
+					// Data elements follow each other without gaps
+					if i+1 < len(variables) && variable.Offset+variable.Size != variables[i+1].Offset {
+						t.Fatalf("Variable %s ends at %d, next one starts at %d", variable.Name, variable.Offset+variable.Size, variables[i+1].Offset)
+					}
+					if i+1 == len(variables) && variable.Offset+variable.Size != info.Size() {
+						t.Fatalf("Variable %s ends at %d, file at %d", variable.Name, variable.Offset+variable.Size, info.Size())
+					}
+				}
+				variable.Offset, variable.Size = 0, 0
+				if !reflect.DeepEqual(variable, tc.variables[i]) {
+					t.Fatalf("Expected: %#v\nGot: %#v", tc.variables[i], variable)
+				}
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	tdir, err := ioutil.TempDir("", "TestGet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	level5 := filepath.Join(tdir, "level5.mat")
+	writeVariablesFile(t, level5, Create)
+	v73 := filepath.Join(tdir, "v73.mat")
+	writeVariablesFile(t, v73, CreateV73)
+	var v4 bytes.Buffer
+	packV4(&v4, binary.LittleEndian, v4Header{Type: 0, Rows: 1, Columns: 2, NameLength: 2}, "x", []float64{1, 2})
+	packV4(&v4, binary.LittleEndian, v4Header{Type: 10, Rows: 1, Columns: 1, NameLength: 2}, "y", []float32{3})
+	level4 := filepath.Join(tdir, "level4.mat")
+	if err := ioutil.WriteFile(level4, v4.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{level5, level4, v73} {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			mat, err := Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer Close(mat)
+
+			first, err := ReadDataElement(mat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// All following elements are compared with the result of Get
+			for {
+				expected, err := ReadDataElement(mat)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				got, err := mat.Get(expected.Name)
+				if err != nil {
+					t.Fatalf("Could not get %s: %v", expected.Name, err)
+				}
+				if !reflect.DeepEqual(got, expected) {
+					t.Fatalf("Expected: %#v\nGot: %#v", expected, got)
+				}
+			}
+			if got, err := mat.Get(first.Name); err != nil || !reflect.DeepEqual(got, first) {
+				t.Fatalf("Expected: %#v\nGot: %#v %v", first, got, err)
+			}
+			if _, err := mat.Get("missing"); err == nil {
+				t.Fatalf("Expected error for missing variable, got none")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	tdir, err := ioutil.TempDir("", "TestLoad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	level5 := filepath.Join(tdir, "level5.mat")
+	writeVariablesFile(t, level5, Create)
+	v73 := filepath.Join(tdir, "v73.mat")
+	writeVariablesFile(t, v73, CreateV73)
+
+	tests := []struct {
+		name  string
+		load  func(m *Matf) (map[string]MatMatrix, error)
+		names []string
+		err   bool
+	}{
+		{name: "All", load: func(m *Matf) (map[string]MatMatrix, error) { return m.Load() },
+			names: []string{"char", "complex", "double", "logical"}},
+		{name: "Names", load: func(m *Matf) (map[string]MatMatrix, error) { return m.Load("double", "char") },
+			names: []string{"char", "double"}},
+		{name: "Missing", load: func(m *Matf) (map[string]MatMatrix, error) { return m.Load("double", "missing") }, err: true},
+		{name: "Regexp", load: func(m *Matf) (map[string]MatMatrix, error) { return m.LoadMatching(regexp.MustCompile("^c")) },
+			names: []string{"char", "complex"}},
+		{name: "NoMatch", load: func(m *Matf) (map[string]MatMatrix, error) { return m.LoadMatching(regexp.MustCompile("^x")) }},
+	}
+
+	for _, file := range []string{level5, v73} {
+		for _, tc := range tests {
+			t.Run(filepath.Base(file)+"/"+tc.name, func(t *testing.T) {
+				mat, err := Open(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer Close(mat)
+
+				mats, err := tc.load(mat)
+				if (err != nil) != tc.err {
+					t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+				}
+				if len(mats) != len(tc.names) {
+					t.Fatalf("Expected %d variables, got %d", len(tc.names), len(mats))
+				}
+				for _, name := range tc.names {
+					expected, err := mat.Get(name)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(mats[name], expected) {
+						t.Fatalf("Expected: %#v\nGot: %#v", expected, mats[name])
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,585 @@
+package matf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// Writer represents a MAT-file, that is opened for writing
+type Writer struct {
+	Header
+	file  *os.File
+	order binary.ByteOrder
+	level int        // zlib compression level, zlib.NoCompression writes plain elements.
+	v73   *v73Writer // Writes the variables as HDF5 file in version 7.3.
+}
+
+// classDataType maps the numeric array types to the data type, which is used
+// to store their values.
+var classDataType = map[int]int{
+	MxDoubleClass: MiDouble,
+	MxSingleClass: MiSingle,
+	MxInt8Class:   MiInt8,
+	MxUint8Class:  MiUint8,
+	MxInt16Class:  MiInt16,
+	MxUint16Class: MiUint16,
+	MxInt32Class:  MiInt32,
+	MxUint32Class: MiUint32,
+	MxInt64Class:  MiInt64,
+	MxUint64Class: MiUint64,
+}
+
+// dataTypeSize returns the number of bytes a single value of a data type needs.
+func dataTypeSize(dataType int) int {
+	switch dataType {
+	case MiInt8, MiUint8, MiUtf8:
+		return 1
+	case MiInt16, MiUint16, MiUtf16:
+		return 2
+	case MiInt32, MiUint32, MiSingle, MiUtf32:
+		return 4
+	case MiInt64, MiUint64, MiDouble:
+		return 8
+	}
+	return 0
+}
+
+func writeHeader(w *Writer, text string, version uint16) error {
+	data := make([]byte, 128)
+
+	copy(data[:116], []byte(fmt.Sprintf("%-116s", text)))
+	w.Header.Text = string(data[:116])
+	w.Header.SubsystemDataOffset = data[116:124]
+	w.Header.Version = version
+	w.order.PutUint16(data[124:126], w.Header.Version)
+	// The EndianIndicator is written in the native byte order of the file
+	w.order.PutUint16(data[126:128], binary.BigEndian.Uint16([]byte{0x4d, 0x49}))
+	w.Header.EndianIndicator = binary.BigEndian.Uint16(data[126:128])
+
+	if _, err := w.file.Write(data); err != nil {
+		return errors.Wrap(err, "\nfile.Write() in writeHeader() failed")
+	}
+	return nil
+}
+
+func packTag(buf *bytes.Buffer, order binary.ByteOrder, dataType, numberOfBytes int) {
+	tag := make([]byte, 8)
+	order.PutUint32(tag[:4], uint32(dataType))
+	order.PutUint32(tag[4:], uint32(numberOfBytes))
+	buf.Write(tag)
+}
+
+func packPadding(buf *bytes.Buffer, numberOfBytes int) {
+	if numberOfBytes%8 != 0 {
+		buf.Write(make([]byte, 8-numberOfBytes%8))
+	}
+}
+
+func packDataElement(buf *bytes.Buffer, order binary.ByteOrder, dataType int, data []byte) {
+	packTag(buf, order, dataType, len(data))
+	buf.Write(data)
+	packPadding(buf, len(data))
+}
+
+// packValue stores value as dataType in data. It returns an error, if the
+// value is out of the range of dataType or can not be represented exactly.
+// Only the precision of floating-point values stored as MiSingle is reduced.
+func packValue(data []byte, order binary.ByteOrder, dataType int, value reflect.Value) error {
+	var f float64
+	var i int64
+	var u uint64
+	var isFloat, isSigned bool
+
+	if value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			f, i, u = 1, 1, 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i = value.Int()
+		f, u = float64(i), uint64(i)
+		isSigned = i < 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u = value.Uint()
+		f, i = float64(u), int64(u)
+	case reflect.Float32, reflect.Float64:
+		f = value.Float()
+		isFloat = true
+	default:
+		return fmt.Errorf("Value of kind %v is not supported", value.Kind())
+	}
+
+	// fits reports, whether the value is an integer between min and max
+	fits := func(min int64, max uint64) bool {
+		switch {
+		case isFloat:
+			// float64(max)+1 is rounded to the next power of two for
+			// math.MaxInt64 and math.MaxUint64
+			if f != math.Trunc(f) || f < float64(min) || f >= float64(max)+1 {
+				return false
+			}
+			if f < 0 {
+				i = int64(f)
+			} else {
+				u = uint64(f)
+				i = int64(u)
+			}
+			return true
+		case isSigned:
+			return i >= min
+		default:
+			return u <= max
+		}
+	}
+
+	var ok bool
+	switch dataType {
+	case MiInt8:
+		if ok = fits(math.MinInt8, math.MaxInt8); ok {
+			data[0] = byte(int8(i))
+		}
+	case MiUint8:
+		if ok = fits(0, math.MaxUint8); ok {
+			data[0] = uint8(u)
+		}
+	case MiInt16:
+		if ok = fits(math.MinInt16, math.MaxInt16); ok {
+			order.PutUint16(data, uint16(int16(i)))
+		}
+	case MiUint16:
+		if ok = fits(0, math.MaxUint16); ok {
+			order.PutUint16(data, uint16(u))
+		}
+	case MiInt32:
+		if ok = fits(math.MinInt32, math.MaxInt32); ok {
+			order.PutUint32(data, uint32(int32(i)))
+		}
+	case MiUint32:
+		if ok = fits(0, math.MaxUint32); ok {
+			order.PutUint32(data, uint32(u))
+		}
+	case MiSingle:
+		if ok = math.IsInf(f, 0) || math.IsNaN(f) || math.Abs(f) <= math.MaxFloat32; ok {
+			order.PutUint32(data, math.Float32bits(float32(f)))
+		}
+	case MiInt64:
+		if ok = fits(math.MinInt64, math.MaxInt64); ok {
+			order.PutUint64(data, uint64(i))
+		}
+	case MiUint64:
+		if ok = fits(0, math.MaxUint64); ok {
+			order.PutUint64(data, u)
+		}
+	case MiDouble:
+		if ok = isFloat || (isSigned && i >= -maxExactInteger) || (!isSigned && u <= maxExactInteger); ok {
+			order.PutUint64(data, math.Float64bits(f))
+		}
+	default:
+		return fmt.Errorf("Data Type %d is not supported", dataType)
+	}
+	if !ok {
+		return fmt.Errorf("Value %v can not be represented exactly by data type %d", value, dataType)
+	}
+	return nil
+}
+
+// splitComplex splits []complex128 and []complex64 values in the real part
+// into a real and an imaginary part. Other values are returned as they are.
+func splitComplex(realPart, imaginaryPart interface{}) (interface{}, interface{}, error) {
+	switch values := realPart.(type) {
+	case []complex128:
+		if imaginaryPart != nil {
+			return nil, nil, fmt.Errorf("Complex values do not take a separate imaginary part")
+		}
+		re, im := make([]float64, len(values)), make([]float64, len(values))
+		for i, value := range values {
+			re[i], im[i] = real(value), imag(value)
+		}
+		return re, im, nil
+	case []complex64:
+		if imaginaryPart != nil {
+			return nil, nil, fmt.Errorf("Complex values do not take a separate imaginary part")
+		}
+		re, im := make([]float32, len(values)), make([]float32, len(values))
+		for i, value := range values {
+			re[i], im[i] = real(value), imag(value)
+		}
+		return re, im, nil
+	}
+	return realPart, imaginaryPart, nil
+}
+
+// packValues converts a slice of numeric values into the raw data of dataType
+func packValues(order binary.ByteOrder, dataType int, values interface{}) ([]byte, error) {
+	if values == nil {
+		return nil, nil
+	}
+	slice := reflect.ValueOf(values)
+	if slice.Kind() != reflect.Slice && slice.Kind() != reflect.Array {
+		return nil, fmt.Errorf("Numeric values of type %T are not supported", values)
+	}
+	size := dataTypeSize(dataType)
+	data := make([]byte, slice.Len()*size)
+	for i := 0; i < slice.Len(); i++ {
+		if err := packValue(data[i*size:], order, dataType, slice.Index(i)); err != nil {
+			return nil, errors.Wrap(err, "\npackValue() in packValues() failed")
+		}
+	}
+	return data, nil
+}
+
+// packChars encodes the rows of a char array column by column in UTF-16
+func packChars(order binary.ByteOrder, chars []string) ([]byte, error) {
+	var rows [][]uint16
+	for _, row := range chars {
+		rows = append(rows, utf16.Encode([]rune(row)))
+		if len(rows[len(rows)-1]) != len(rows[0]) {
+			return nil, fmt.Errorf("All rows of a char array need to have the same length")
+		}
+	}
+	var data []byte
+	if len(rows) > 0 {
+		data = make([]byte, 2*len(rows)*len(rows[0]))
+		var i int
+		for column := range rows[0] {
+			for _, row := range rows {
+				order.PutUint16(data[i:], row[column])
+				i += 2
+			}
+		}
+	}
+	return data, nil
+}
+
+func packFieldNames(buf *bytes.Buffer, order binary.ByteOrder, fieldNames []string) {
+	fieldNameLength := 32
+	for _, name := range fieldNames {
+		name = strings.TrimRight(name, "\x00")
+		if len(name)+1 > fieldNameLength {
+			fieldNameLength = len(name) + 1
+		}
+	}
+
+	// Field Name Length is always stored as Small Data Element
+	small := make([]byte, 8)
+	order.PutUint16(small[0:2], uint16(MiInt32))
+	order.PutUint16(small[2:4], 4)
+	order.PutUint32(small[4:8], uint32(fieldNameLength))
+	buf.Write(small)
+
+	names := make([]byte, fieldNameLength*len(fieldNames))
+	for i, name := range fieldNames {
+		copy(names[i*fieldNameLength:], strings.TrimRight(name, "\x00"))
+	}
+	packDataElement(buf, order, MiInt8, names)
+}
+
+func packClass(buf *bytes.Buffer, mat MatMatrix, order binary.ByteOrder) error {
+	elements := mat.Dim.NumElements()
+	switch int(mat.Class) {
+	case MxCellClass:
+		content, ok := mat.Content.(CellPrt)
+		if !ok {
+			return fmt.Errorf("Content of type %T does not match class %d", mat.Content, mat.Class)
+		}
+		if len(content.Cells) != elements {
+			return fmt.Errorf("Cell array of %d elements contains %d cells", elements, len(content.Cells))
+		}
+		for _, cell := range content.Cells {
+			cell.Name = ""
+			if err := packMatrix(buf, cell, order); err != nil {
+				return err
+			}
+		}
+	case MxStructClass:
+		content, ok := mat.Content.(StructPrt)
+		if !ok {
+			return fmt.Errorf("Content of type %T does not match class %d", mat.Content, mat.Class)
+		}
+		packFieldNames(buf, order, content.FieldNames)
+		var numberOfElements int
+		for _, name := range content.FieldNames {
+			if len(content.FieldValues[name]) > numberOfElements {
+				numberOfElements = len(content.FieldValues[name])
+			}
+		}
+		if numberOfElements > elements {
+			return fmt.Errorf("Struct array of %d elements contains %d values", elements, numberOfElements)
+		}
+		for i := 0; i < elements; i++ {
+			for _, name := range content.FieldNames {
+				var field MatMatrix
+				if i < len(content.FieldValues[name]) {
+					element, ok := content.FieldValues[name][i].(MatMatrix)
+					if !ok {
+						return fmt.Errorf("Value of field %s is not a MatMatrix", name)
+					}
+					field = element
+				} else {
+					// Fields without a value are stored as empty double array
+					field = MatMatrix{Class: uint32(MxDoubleClass), Content: NumPrt{}}
+				}
+				field.Name = ""
+				if err := packMatrix(buf, field, order); err != nil {
+					return err
+				}
+			}
+		}
+	case MxCharClass:
+		content, ok := mat.Content.(CharPrt)
+		if !ok {
+			return fmt.Errorf("Content of type %T does not match class %d", mat.Content, mat.Class)
+		}
+		data, err := packChars(order, content.Chars)
+		if err != nil {
+			return err
+		}
+		if len(data) != 2*elements {
+			return fmt.Errorf("Char array of %d elements contains %d characters", elements, len(data)/2)
+		}
+		packDataElement(buf, order, MiUint16, data)
+	case MxDoubleClass, MxSingleClass, MxInt8Class, MxUint8Class, MxInt16Class,
+		MxUint16Class, MxInt32Class, MxUint32Class, MxInt64Class, MxUint64Class:
+		content, ok := mat.Content.(NumPrt)
+		if !ok {
+			return fmt.Errorf("Content of type %T does not match class %d", mat.Content, mat.Class)
+		}
+		dataType := classDataType[int(mat.Class)]
+		// Real part and optional imaginary part
+		parts := []interface{}{content.RealPart}
+		if FlagComplex&mat.Flags == FlagComplex {
+			parts = append(parts, content.ImaginaryPart)
+		}
+		for _, values := range parts {
+			data, err := packValues(order, dataType, values)
+			if err != nil {
+				return errors.Wrap(err, "\npackValues() in packClass() failed")
+			}
+			if len(data) != elements*dataTypeSize(dataType) {
+				return fmt.Errorf("Array of %d elements contains %d values", elements, len(data)/dataTypeSize(dataType))
+			}
+			packDataElement(buf, order, dataType, data)
+		}
+	case MxOpaqueClass:
+		content, ok := mat.Content.(OpaquePrt)
+		if !ok {
+			return fmt.Errorf("Content of type %T does not match class %d", mat.Content, mat.Class)
+		}
+		packDataElement(buf, order, MiInt8, []byte(content.TypeSystem))
+		packDataElement(buf, order, MiInt8, []byte(content.ClassName))
+		metadata := content.Metadata
+		metadata.Name = ""
+		if err := packMatrix(buf, metadata, order); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("This type of class is not supported yet: %d", mat.Class)
+	}
+	return nil
+}
+
+// checkNumElements returns an error, if the number of elements of dims, that
+// the content of a matrix is checked against, exceeds the range of int.
+func checkNumElements(dims []int) error {
+	const maxInt = int(^uint(0) >> 1)
+	for _, dim := range dims {
+		if dim == 0 {
+			return nil
+		}
+	}
+	elements := 1
+	for _, dim := range dims {
+		if elements > maxInt/dim {
+			return fmt.Errorf("Number of elements of dimensions %v exceeds the range of int", dims)
+		}
+		elements *= dim
+	}
+	return nil
+}
+
+func packMatrix(buf *bytes.Buffer, mat MatMatrix, order binary.ByteOrder) error {
+	var body bytes.Buffer
+
+	if mat.Class == 0 {
+		mat.Class = mat.Flags & ClassMask
+	}
+	if content, ok := mat.Content.(NumPrt); ok {
+		re, im, err := splitComplex(content.RealPart, content.ImaginaryPart)
+		if err != nil {
+			return errors.Wrap(err, "\nsplitComplex() in packMatrix() failed")
+		}
+		content.RealPart, content.ImaginaryPart = re, im
+		mat.Content = content
+		if im != nil {
+			mat.Flags |= FlagComplex
+		}
+	}
+
+	// Array Flags
+	arrayFlags := make([]byte, 8)
+	order.PutUint32(arrayFlags[:4], mat.Flags&^ClassMask|mat.Class)
+	packDataElement(&body, order, MiUint32, arrayFlags)
+
+	// Opaque objects do not have a dimensions array
+	if int(mat.Class) != MxOpaqueClass {
+		// Dimensions Array
+		// MATLAB expects at least two dimensions
+		dims := append([]int{}, mat.Dim...)
+		switch len(dims) {
+		case 0:
+			dims = []int{0, 0}
+		case 1:
+			dims = append(dims, 1)
+		}
+		dimensions := make([]byte, 4*len(dims))
+		for i, dim := range dims {
+			if dim < 0 || dim > math.MaxInt32 {
+				return fmt.Errorf("Invalid size of dimension %d: %d", i, dim)
+			}
+			order.PutUint32(dimensions[i*4:], uint32(dim))
+		}
+		if err := checkNumElements(dims); err != nil {
+			return errors.Wrap(err, "\ncheckNumElements() in packMatrix() failed")
+		}
+		packDataElement(&body, order, MiInt32, dimensions)
+	}
+
+	// Array Name
+	packDataElement(&body, order, MiInt8, []byte(mat.Name))
+
+	if err := packClass(&body, mat, order); err != nil {
+		return errors.Wrap(err, "\npackClass() in packMatrix() failed")
+	}
+
+	packTag(buf, order, MiMatrix, body.Len())
+	buf.Write(body.Bytes())
+	return nil
+}
+
+func compressData(data []byte, level int) ([]byte, error) {
+	var out bytes.Buffer
+	w, err := zlib.NewWriterLevel(&out, level)
+	if err != nil {
+		return []byte{}, errors.Wrap(err, "\nzlib.NewWriterLevel() in compressData() failed")
+	}
+	if _, err := w.Write(data); err != nil {
+		return []byte{}, errors.Wrap(err, "\nzlib.Write() in compressData() failed")
+	}
+	if err := w.Close(); err != nil {
+		return []byte{}, errors.Wrap(err, "\nzlib.Close() in compressData() failed")
+	}
+	return out.Bytes(), nil
+}
+
+// Create a MAT-file and writes the header information into it.
+func Create(file string) (*Writer, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+
+	w := new(Writer)
+	w.file = f
+	w.order = binary.LittleEndian
+
+	text := fmt.Sprintf("MATLAB 5.0 MAT-file, written by matf, Created on: %s", time.Now().UTC().Format(time.ANSIC))
+	if err := writeHeader(w, text, 0x0100); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "\nwriteHeader() in Create() failed")
+	}
+
+	return w, nil
+}
+
+// CreateV73 creates a MAT-file in version 7.3, which is a HDF5 file behind a
+// 512 byte header. Variables are compressed with zlib.DefaultCompression
+// unless SetCompression changes it. The file is complete after Close.
+func CreateV73(file string) (*Writer, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+
+	w := new(Writer)
+	w.file = f
+	w.order = binary.LittleEndian
+	w.level = zlib.DefaultCompression
+	w.v73 = &v73Writer{h: newHDF5Writer(f, 512)}
+
+	text := fmt.Sprintf("MATLAB 7.3 MAT-file, written by matf, Created on: %s HDF5 schema 1.00 .", time.Now().UTC().Format(time.ANSIC))
+	if err := writeHeader(w, text, 0x0200); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "\nwriteHeader() in CreateV73() failed")
+	}
+
+	return w, nil
+}
+
+// WriteDataElement appends mat as data element to the MAT-file.
+func (w *Writer) WriteDataElement(mat MatMatrix) error {
+	var buf bytes.Buffer
+
+	if len(mat.Name) == 0 {
+		return fmt.Errorf("Data element without name can not be written")
+	}
+	if w.v73 != nil {
+		if err := w.v73.write(mat, w.level); err != nil {
+			return errors.Wrap(err, "\nwrite() in WriteDataElement() failed")
+		}
+		return nil
+	}
+	if err := packMatrix(&buf, mat, w.order); err != nil {
+		return errors.Wrap(err, "\npackMatrix() in WriteDataElement() failed")
+	}
+	if w.level != zlib.NoCompression {
+		data, err := compressData(buf.Bytes(), w.level)
+		if err != nil {
+			return errors.Wrap(err, "\ncompressData() in WriteDataElement() failed")
+		}
+		buf.Reset()
+		// Compressed data elements are not padded
+		packTag(&buf, w.order, MiCompressed, len(data))
+		buf.Write(data)
+	}
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return errors.Wrap(err, "\nfile.Write() in WriteDataElement() failed")
+	}
+	return nil
+}
+
+// SetCompression sets the zlib compression level for all following data
+// elements. Each element is then written as miCOMPRESSED element, like
+// MATLAB does since version 7. In MAT-files of version 7.3 the chunks of each
+// dataset are deflated instead. zlib.NoCompression disables the compression.
+func (w *Writer) SetCompression(level int) error {
+	if level < zlib.HuffmanOnly || level > zlib.BestCompression {
+		return fmt.Errorf("Invalid compression level: %d", level)
+	}
+	w.level = level
+	return nil
+}
+
+// Close the MAT-file
+func (w *Writer) Close() error {
+	if w.v73 != nil {
+		if err := w.v73.close(); err != nil {
+			w.file.Close()
+			return errors.Wrap(err, "\nclose() in Close() failed")
+		}
+	}
+	return w.file.Close()
+}
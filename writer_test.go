@@ -0,0 +1,533 @@
+package matf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPackMatrix(t *testing.T) {
+	t.Parallel()
+
+	// The writer does not set the undefined second word of the array flags
+	simpleMatrix := append([]byte{}, verySimpleMatrix...)
+	simpleMatrix[12] = 0x00
+
+	tests := []struct {
+		name string
+		mat  MatMatrix
+		data []byte
+		err  string
+	}{
+		{name: "MaTrIx", mat: MatMatrix{Name: "MaTrIx", Class: uint32(MxDoubleClass), Dim: Dim{3, 3}, Content: NumPrt{RealPart: []interface{}{1, 0, 1, 0, 1, 0, 1, 0, 1}}}, data: simpleMatrix},
+		{name: "ContentMismatch", mat: MatMatrix{Name: "mismatch", Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: CharPrt{}}, err: "does not match class"},
+		{name: "UnknownClass", mat: MatMatrix{Name: "unknown", Class: 42, Dim: Dim{1, 1}}, err: "not supported yet"},
+		{name: "UnknownValue", mat: MatMatrix{Name: "value", Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []interface{}{"1"}}}, err: "is not supported"},
+		{name: "UnequalRows", mat: MatMatrix{Name: "rows", Class: uint32(MxCharClass), Dim: Dim{2, 2}, Content: CharPrt{Chars: []string{"ab", "c"}}}, err: "same length"},
+		{name: "TooFewValues", mat: MatMatrix{Name: "values", Class: uint32(MxDoubleClass), Dim: Dim{2, 2}, Content: NumPrt{RealPart: []float64{1, 2, 3}}}, err: "contains 3 values"},
+		{name: "TooFewImaginary", mat: MatMatrix{Name: "values", Class: uint32(MxDoubleClass), Flags: FlagComplex, Dim: Dim{1, 2}, Content: NumPrt{RealPart: []float64{1, 2}, ImaginaryPart: []float64{1}}}, err: "contains 1 values"},
+		{name: "TooManyCells", mat: MatMatrix{Name: "cells", Class: uint32(MxCellClass), Dim: Dim{1, 1}, Content: CellPrt{Cells: []MatMatrix{{}, {}}}}, err: "contains 2 cells"},
+		{name: "TooManyChars", mat: MatMatrix{Name: "chars", Class: uint32(MxCharClass), Dim: Dim{1, 2}, Content: CharPrt{Chars: []string{"abc"}}}, err: "contains 3 characters"},
+		{name: "TooManyFieldValues", mat: MatMatrix{Name: "struct", Class: uint32(MxStructClass), Dim: Dim{1, 1}, Content: StructPrt{FieldNames: []string{"a"}, FieldValues: map[string][]interface{}{"a": {MatMatrix{}, MatMatrix{}}}}}, err: "contains 2 values"},
+		{name: "NegativeDim", mat: MatMatrix{Name: "dims", Class: uint32(MxDoubleClass), Dim: Dim{-1, 1}, Content: NumPrt{}}, err: "Invalid size of dimension 0"},
+		{name: "HugeDim", mat: MatMatrix{Name: "dims", Class: uint32(MxDoubleClass), Dim: Dim{1, 1 << 31}, Content: NumPrt{}}, err: "Invalid size of dimension 1"},
+		{name: "OverflowDims", mat: MatMatrix{Name: "dims", Class: uint32(MxDoubleClass), Dim: Dim{1<<31 - 1, 1<<31 - 1, 1<<31 - 1}, Content: NumPrt{}}, err: "exceeds the range of int"},
+		{name: "OutOfRange", mat: MatMatrix{Name: "int8", Class: uint32(MxInt8Class), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{300.7}}}, err: "can not be represented"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := packMatrix(&buf, tc.mat, binary.LittleEndian)
+			if err != nil {
+				if matched, _ := regexp.MatchString(tc.err, err.Error()); !matched {
+					t.Fatalf("Error matching regex: %v \t Got: %v", tc.err, err)
+				} else {
+					return
+				}
+				t.Fatalf("Expected no error, got: %v", err)
+			} else if len(tc.err) != 0 {
+				t.Fatalf("Expected error, got none")
+			}
+			// Skip the tag of the miMATRIX element
+			if !bytes.Equal(buf.Bytes()[8:], tc.data) {
+				t.Fatalf("Expected: %#v\nGot: %#v", tc.data, buf.Bytes()[8:])
+			}
+		})
+	}
+}
+
+func TestPackValue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		dataType int
+		data     []byte
+		err      bool
+	}{
+		{name: "Int8", value: -128, dataType: MiInt8, data: []byte{0x80}},
+		{name: "Int8Overflow", value: 128, dataType: MiInt8, err: true},
+		{name: "Uint8Negative", value: int8(-1), dataType: MiUint8, err: true},
+		{name: "Uint8Float", value: 255.0, dataType: MiUint8, data: []byte{0xFF}},
+		{name: "Int8Float", value: 300.7, dataType: MiInt8, err: true},
+		{name: "Fraction", value: 1.5, dataType: MiInt32, err: true},
+		{name: "NaN", value: math.NaN(), dataType: MiInt16, err: true},
+		{name: "Uint16", value: uint64(65535), dataType: MiUint16, data: []byte{0xFF, 0xFF}},
+		{name: "Int64Float", value: float64(1 << 63), dataType: MiInt64, err: true},
+		{name: "Uint64Float", value: float64(1 << 63), dataType: MiUint64, data: []byte{0, 0, 0, 0, 0, 0, 0, 0x80}},
+		{name: "Uint64Overflow", value: float64(1 << 64), dataType: MiUint64, err: true},
+		{name: "Int64Uint64", value: uint64(1 << 63), dataType: MiInt64, err: true},
+		{name: "SingleOverflow", value: 1e39, dataType: MiSingle, err: true},
+		{name: "SingleInf", value: math.Inf(-1), dataType: MiSingle, data: []byte{0, 0, 0x80, 0xFF}},
+		{name: "DoubleInt64", value: int64(1<<53 + 1), dataType: MiDouble, err: true},
+		{name: "DoubleNegative", value: int64(-1), dataType: MiDouble, data: []byte{0, 0, 0, 0, 0, 0, 0xF0, 0xBF}},
+		{name: "Bool", value: true, dataType: MiUint8, data: []byte{1}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data := make([]byte, dataTypeSize(tc.dataType))
+			err := packValue(data, binary.LittleEndian, tc.dataType, reflect.ValueOf(tc.value))
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v\tGot: %v", tc.err, err)
+			}
+			if err == nil && !bytes.Equal(data, tc.data) {
+				t.Fatalf("Expected: %#v\tGot: %#v", tc.data, data)
+			}
+		})
+	}
+}
+
+func TestCompressData(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input []byte
+		level int
+		err   string
+	}{
+		{name: "DeadCell", input: []byte{0xDE, 0xAD, 0xCE, 0x11}, level: zlib.DefaultCompression},
+		{name: "BestSpeed", input: verySimpleMatrix, level: zlib.BestSpeed},
+		{name: "InvalidLevel", input: verySimpleMatrix, level: 42, err: "invalid compression level"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			compressed, err := compressData(tc.input, tc.level)
+			if err != nil {
+				if matched, _ := regexp.MatchString(tc.err, err.Error()); !matched {
+					t.Fatalf("Error matching regex: %v \t Got: %v", tc.err, err)
+				} else {
+					return
+				}
+				t.Fatalf("Expected no error, got: %v", err)
+			} else if len(tc.err) != 0 {
+				t.Fatalf("Expected error, got none")
+			}
+			output, err := decompressData(compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(output, tc.input) {
+				t.Fatalf("Expected: %#v\tGot: %#v", tc.input, output)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tdir, ferr := ioutil.TempDir("", "TestWriter")
+	if ferr != nil {
+		t.Fatal(ferr)
+	}
+	defer os.RemoveAll(tdir)
+
+	elements := []MatMatrix{
+		{Name: "double", Class: uint32(MxDoubleClass), Dim: Dim{2, 2}, Content: NumPrt{RealPart: []float64{1, 2, 3, 4}}},
+		{Name: "complex", Class: uint32(MxSingleClass), Flags: FlagComplex, Dim: Dim{1, 2}, Content: NumPrt{RealPart: []float32{1, 2}, ImaginaryPart: []float32{3, 4}}},
+		{Name: "image", Class: uint32(MxUint8Class), Dim: Dim{2, 1, 2, 2, 1}, Content: NumPrt{RealPart: []uint8{1, 2, 3, 4, 5, 6, 7, 8}}},
+		{Name: "char", Class: uint32(MxCharClass), Dim: Dim{1, 5}, Content: CharPrt{Chars: []string{"hello"}}},
+		{Name: "chars", Class: uint32(MxCharClass), Dim: Dim{2, 3}, Content: CharPrt{Chars: []string{"abc", "äöü"}}},
+		{Name: "int16", Class: uint32(MxInt16Class), Dim: Dim{1, 3}, Content: NumPrt{RealPart: []interface{}{int16(-1), int16(0), int16(1)}}},
+		{Name: "logical", Class: uint32(MxUint8Class), Flags: FlagLogical, Dim: Dim{1, 2}, Content: NumPrt{RealPart: []bool{true, false}}},
+		{Name: "cell", Class: uint32(MxCellClass), Dim: Dim{1, 2}, Content: CellPrt{Cells: []MatMatrix{
+			{Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{42}}},
+			{Class: uint32(MxUint8Class), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []uint8{7}}},
+		}}},
+		{Name: "struct", Class: uint32(MxStructClass), Dim: Dim{1, 1}, Content: StructPrt{
+			FieldNames: []string{"a", "bb"},
+			FieldValues: map[string][]interface{}{
+				"a":  {MatMatrix{Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{1}}}},
+				"bb": {MatMatrix{Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{2}}}},
+			},
+		}},
+	}
+
+	for _, level := range []int{zlib.NoCompression, zlib.DefaultCompression, zlib.BestCompression} {
+		t.Run(fmt.Sprintf("level %d", level), func(t *testing.T) {
+			testWriter(t, filepath.Join(tdir, fmt.Sprintf("writer%d.mat", level)), level, elements)
+		})
+	}
+}
+
+func testWriter(t *testing.T, name string, level int, elements []MatMatrix) {
+	w, err := Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetCompression(42); err == nil {
+		t.Fatalf("Expected error for invalid compression level, got none")
+	}
+	if err := w.SetCompression(level); err != nil {
+		t.Fatal(err)
+	}
+	for _, element := range elements {
+		if err := w.WriteDataElement(element); err != nil {
+			t.Fatalf("Could not write %s: %v", element.Name, err)
+		}
+	}
+	if err := w.WriteDataElement(MatMatrix{Class: uint32(MxDoubleClass)}); err == nil {
+		t.Fatalf("Expected error for element without name, got none")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(r)
+
+	if !strings.HasPrefix(r.Header.Text, "MATLAB 5.0 MAT-file") {
+		t.Fatalf("Unexpected header text: %s", r.Header.Text)
+	}
+
+	for _, expected := range elements {
+		mat, err := ReadDataElement(r)
+		if err != nil {
+			t.Fatalf("Could not read %s: %v", expected.Name, err)
+		}
+		if mat.Name != expected.Name || mat.Class != expected.Class || !reflect.DeepEqual(mat.Dim, expected.Dim) {
+			t.Fatalf("Expected: %s %d %v\tGot: %s %d %v", expected.Name, expected.Class, expected.Dim, mat.Name, mat.Class, mat.Dim)
+		}
+		if mat.Flags&^ClassMask != expected.Flags {
+			t.Fatalf("Flags\tExpected: %#x\tGot: %#x", expected.Flags, mat.Flags&^ClassMask)
+		}
+		switch content := mat.Content.(type) {
+		case NumPrt:
+			expectedContent := expected.Content.(NumPrt)
+			if reflect.ValueOf(content.RealPart).Len() != reflect.ValueOf(expectedContent.RealPart).Len() {
+				t.Fatalf("Expected: %#v\tGot: %#v", expectedContent.RealPart, content.RealPart)
+			}
+		case CharPrt:
+			if !reflect.DeepEqual(content, expected.Content) {
+				t.Fatalf("Expected: %#v\tGot: %#v", expected.Content, content)
+			}
+		case CellPrt:
+			if len(content.Cells) != len(expected.Content.(CellPrt).Cells) {
+				t.Fatalf("Expected: %#v\tGot: %#v", expected.Content, content)
+			}
+		case StructPrt:
+			for i, name := range content.FieldNames {
+				if strings.TrimRight(name, "\x00") != expected.Content.(StructPrt).FieldNames[i] {
+					t.Fatalf("Expected field %s\tGot: %s", expected.Content.(StructPrt).FieldNames[i], name)
+				}
+			}
+		}
+	}
+
+	if _, err := ReadDataElement(r); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got: %v", err)
+	}
+}
+
+func TestWriterV73(t *testing.T) {
+	tdir, ferr := ioutil.TempDir("", "TestWriterV73")
+	if ferr != nil {
+		t.Fatal(ferr)
+	}
+	defer os.RemoveAll(tdir)
+
+	scalar := func(v float64) MatMatrix {
+		return MatMatrix{Flags: uint32(MxDoubleClass), Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{v}, DataType: MiDouble}}
+	}
+	var large []float64
+	for i := 0; i < 3000; i++ {
+		large = append(large, float64(i))
+	}
+	var matrix []int16
+	for i := int16(0); i < 63; i++ {
+		matrix = append(matrix, i)
+	}
+
+	// Elements are given in the form, the reader returns them
+	elements := []MatMatrix{
+		{Name: "double", Flags: uint32(MxDoubleClass), Class: uint32(MxDoubleClass), Dim: Dim{2, 3},
+			Content: NumPrt{RealPart: []float64{1, 2, 3, 4, 5, 6}, DataType: MiDouble}},
+		{Name: "large", Flags: uint32(MxDoubleClass), Class: uint32(MxDoubleClass), Dim: Dim{1, 3000}, Content: NumPrt{RealPart: large, DataType: MiDouble}},
+		{Name: "matrix", Flags: uint32(MxInt16Class), Class: uint32(MxInt16Class), Dim: Dim{7, 9}, Content: NumPrt{RealPart: matrix, DataType: MiInt16}},
+		{Name: "complex", Flags: FlagComplex | uint32(MxSingleClass), Class: uint32(MxSingleClass), Dim: Dim{1, 2},
+			Content: NumPrt{RealPart: []float32{1, 2}, ImaginaryPart: []float32{3, 4}, DataType: MiSingle}},
+		{Name: "logical", Flags: FlagLogical | uint32(MxUint8Class), Class: uint32(MxUint8Class), Dim: Dim{1, 2},
+			Content: NumPrt{RealPart: []uint8{1, 0}, DataType: MiUint8}},
+		{Name: "chars", Flags: uint32(MxCharClass), Class: uint32(MxCharClass), Dim: Dim{2, 3}, Content: CharPrt{Chars: []string{"abc", "äöü"}}},
+		{Name: "empty", Flags: uint32(MxDoubleClass), Class: uint32(MxDoubleClass), Dim: Dim{0, 3}, Content: NumPrt{}},
+		{Name: "cell", Flags: uint32(MxCellClass), Class: uint32(MxCellClass), Dim: Dim{1, 2}, Content: CellPrt{Cells: []MatMatrix{
+			scalar(42),
+			{Flags: uint32(MxCellClass), Class: uint32(MxCellClass), Dim: Dim{1, 1}, Content: CellPrt{Cells: []MatMatrix{scalar(7)}}},
+		}}},
+		{Name: "struct", Flags: uint32(MxStructClass), Class: uint32(MxStructClass), Dim: Dim{1, 1}, Content: StructPrt{
+			FieldNames:  []string{"b", "a"},
+			FieldValues: map[string][]interface{}{"a": {scalar(1)}, "b": {scalar(2)}},
+		}},
+		{Name: "structArray", Flags: uint32(MxStructClass), Class: uint32(MxStructClass), Dim: Dim{1, 2}, Content: StructPrt{
+			FieldNames:  []string{"v"},
+			FieldValues: map[string][]interface{}{"v": {scalar(1), scalar(2)}},
+		}},
+		{Name: "emptyStruct", Flags: uint32(MxStructClass), Class: uint32(MxStructClass), Dim: Dim{0, 1}, Content: StructPrt{
+			FieldNames:  []string{"x"},
+			FieldValues: map[string][]interface{}{},
+		}},
+		{Name: "sparse", Flags: uint32(MxSparseClass), Class: uint32(MxSparseClass), Dim: Dim{3, 2},
+			Content: SparsePrt{RowIndex: []int{2, 0}, ColumnPointer: []int{0, 1, 2}, NzMax: 2, RealPart: []float64{1, 2}}},
+		{Name: "sparseLogical", Flags: FlagLogical | uint32(MxSparseClass), Class: uint32(MxSparseClass), Dim: Dim{2, 2},
+			Content: SparsePrt{RowIndex: []int{1}, ColumnPointer: []int{0, 0, 1}, NzMax: 1, RealPart: []bool{true}}},
+	}
+	// Hundreds of variables need more than one level in the B-tree of a group
+	for i := 0; i < 300; i++ {
+		element := scalar(float64(i))
+		element.Name = fmt.Sprintf("v%03d", i)
+		elements = append(elements, element)
+	}
+
+	for _, level := range []int{zlib.NoCompression, zlib.DefaultCompression} {
+		t.Run(fmt.Sprintf("level %d", level), func(t *testing.T) {
+			name := filepath.Join(tdir, fmt.Sprintf("writer%d.mat", level))
+			w, err := CreateV73(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Small chunks need more than one level in the B-tree of a dataset
+			w.v73.h.chunkSize = 64
+			if err := w.SetCompression(level); err != nil {
+				t.Fatal(err)
+			}
+			for _, element := range elements {
+				if err := w.WriteDataElement(element); err != nil {
+					t.Fatalf("Could not write %s: %v", element.Name, err)
+				}
+			}
+			if err := w.WriteDataElement(elements[0]); err == nil {
+				t.Fatalf("Expected error for duplicate variable, got none")
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer Close(r)
+			if !strings.HasPrefix(r.Header.Text, "MATLAB 7.3 MAT-file") {
+				t.Fatalf("Unexpected header text: %s", r.Header.Text)
+			}
+
+			read := make(map[string]MatMatrix)
+			for {
+				mat, err := ReadDataElement(r)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				read[mat.Name] = mat
+			}
+			if len(read) != len(elements) {
+				t.Fatalf("Expected %d variables, got %d", len(elements), len(read))
+			}
+			for _, expected := range elements {
+				if !reflect.DeepEqual(read[expected.Name], expected) {
+					t.Fatalf("Expected: %#v\nGot: %#v", expected, read[expected.Name])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteComplexValues(t *testing.T) {
+	tdir, ferr := ioutil.TempDir("", "TestWriteComplexValues")
+	if ferr != nil {
+		t.Fatal(ferr)
+	}
+	defer os.RemoveAll(tdir)
+
+	doubles := []complex128{1 + 2i, -3.5, 4i}
+	singles := []complex64{0.5 - 1i}
+	tests := []struct {
+		name   string
+		create func(string) (*Writer, error)
+	}{
+		{name: "Level5", create: Create},
+		{name: "V73", create: CreateV73},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(tdir, tc.name+".mat")
+			w, err := tc.create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			invalid := MatMatrix{Name: "invalid", Class: uint32(MxDoubleClass), Dim: Dim{1, 1},
+				Content: NumPrt{RealPart: []complex128{1}, ImaginaryPart: []float64{1}}}
+			if err := w.WriteDataElement(invalid); err == nil {
+				t.Fatalf("Expected error for complex values with imaginary part, got none")
+			}
+			for _, mat := range []MatMatrix{
+				{Name: "doubles", Class: uint32(MxDoubleClass), Dim: Dim{1, 3}, Content: NumPrt{RealPart: doubles}},
+				{Name: "singles", Class: uint32(MxSingleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: singles}},
+			} {
+				if err := w.WriteDataElement(mat); err != nil {
+					t.Fatalf("Could not write %s: %v", mat.Name, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer Close(r)
+			mat, err := r.Get("doubles")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mat.Flags&FlagComplex != FlagComplex {
+				t.Fatalf("Expected complex flag, got flags %#x", mat.Flags)
+			}
+			if values, err := mat.Complex128s(); err != nil || !reflect.DeepEqual(values, doubles) {
+				t.Fatalf("Expected: %v\tGot: %v %v", doubles, values, err)
+			}
+			mat, err = r.Get("singles")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if values, err := mat.Complex64s(); err != nil || !reflect.DeepEqual(values, singles) {
+				t.Fatalf("Expected: %v\tGot: %v %v", singles, values, err)
+			}
+		})
+	}
+}
+
+func TestWriterV73DeflateLevel(t *testing.T) {
+	tdir, ferr := ioutil.TempDir("", "TestWriterV73DeflateLevel")
+	if ferr != nil {
+		t.Fatal(ferr)
+	}
+	defer os.RemoveAll(tdir)
+
+	tests := []struct {
+		level    int
+		expected int
+	}{
+		{level: zlib.DefaultCompression, expected: 6},
+		{level: zlib.HuffmanOnly, expected: 6},
+		{level: zlib.BestSpeed, expected: 1},
+		{level: zlib.BestCompression, expected: 9},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("level %d", tc.level), func(t *testing.T) {
+			name := filepath.Join(tdir, fmt.Sprintf("level%d.mat", tc.level))
+			w, err := CreateV73(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.SetCompression(tc.level); err != nil {
+				t.Fatal(err)
+			}
+			mat := MatMatrix{Name: "x", Class: uint32(MxDoubleClass), Dim: Dim{1, 3}, Content: NumPrt{RealPart: []float64{1, 2, 3}}}
+			if err := w.WriteDataElement(mat); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer Close(r)
+			object, err := r.v73.file.readObject(r.v73.variables[0].address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dataset, err := r.v73.file.dataset(object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dataset.filters) != 1 || dataset.filters[0].id != hdf5Deflate {
+				t.Fatalf("Expected deflate filter, got: %#v", dataset.filters)
+			}
+			if values := dataset.filters[0].values; len(values) != 1 || values[0] != tc.expected {
+				t.Fatalf("Expected level %d, got: %v", tc.expected, values)
+			}
+		})
+	}
+}
+
+func TestWriterV73Errors(t *testing.T) {
+	tdir, ferr := ioutil.TempDir("", "TestWriterV73Errors")
+	if ferr != nil {
+		t.Fatal(ferr)
+	}
+	defer os.RemoveAll(tdir)
+
+	w, err := CreateV73(filepath.Join(tdir, "errors.mat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	tests := []struct {
+		name string
+		mat  MatMatrix
+	}{
+		{name: "Reserved", mat: MatMatrix{Name: "#refs#", Class: uint32(MxDoubleClass), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{1}}}},
+		{name: "Values", mat: MatMatrix{Name: "values", Class: uint32(MxDoubleClass), Dim: Dim{2, 2}, Content: NumPrt{RealPart: []float64{1}}}},
+		{name: "Imaginary", mat: MatMatrix{Name: "imaginary", Class: uint32(MxDoubleClass), Flags: FlagComplex, Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{1}}}},
+		{name: "Cells", mat: MatMatrix{Name: "cells", Class: uint32(MxCellClass), Dim: Dim{1, 2}, Content: CellPrt{}}},
+		{name: "EmptyCells", mat: MatMatrix{Name: "cells", Class: uint32(MxCellClass), Dim: Dim{0, 0}, Content: CellPrt{Cells: []MatMatrix{{}}}}},
+		{name: "EmptyValues", mat: MatMatrix{Name: "values", Class: uint32(MxDoubleClass), Dim: Dim{1, 0}, Content: NumPrt{RealPart: []float64{1}}}},
+		{name: "FieldValues", mat: MatMatrix{Name: "struct", Class: uint32(MxStructClass), Dim: Dim{1, 1}, Content: StructPrt{FieldNames: []string{"a"}, FieldValues: map[string][]interface{}{"a": {MatMatrix{}, MatMatrix{}}}}}},
+		{name: "OutOfRange", mat: MatMatrix{Name: "int8", Class: uint32(MxInt8Class), Dim: Dim{1, 1}, Content: NumPrt{RealPart: []float64{300.7}}}},
+		{name: "Sparse", mat: MatMatrix{Name: "sparse", Class: uint32(MxSparseClass), Dim: Dim{2, 2}, Content: SparsePrt{ColumnPointer: []int{0}}}},
+		{name: "Opaque", mat: MatMatrix{Name: "opaque", Class: uint32(MxOpaqueClass), Content: OpaquePrt{}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := w.WriteDataElement(tc.mat); err == nil {
+				t.Fatalf("Expected error, got none")
+			}
+		})
+	}
+}